@@ -0,0 +1,268 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package crawl implements a polite, archive-aware web crawler used by
+// Amass's web archive data sources. It honors robots.txt, seeds itself from
+// sitemap.xml, and adapts its per-host concurrency to the responses it
+// receives instead of hammering every host at a fixed rate.
+package crawl
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/fetchbot"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/lanzay/amass/amass/utils"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Config tunes a Crawler's politeness and budget.
+type Config struct {
+	// IdleTimeout ends the crawl once this long has elapsed without a new
+	// page being discovered, instead of the fixed timer the old crawler used.
+	IdleTimeout time.Duration
+	// MaxPages bounds the total number of pages fetched across the crawl.
+	MaxPages int
+	// UserAgent identifies the crawler to the sites it visits, and is also
+	// the agent string matched against robots.txt rules.
+	UserAgent string
+	// CacheDir, when set, conditions every GET against a WebCache rooted
+	// there, so repeat scans of the same archive pages skip re-downloading
+	// anything whose ETag/Last-Modified hasn't changed.
+	CacheDir string
+}
+
+// DefaultConfig returns sane defaults for Config, including a CacheDir
+// under the user's cache directory so repeat crawls of the same archive
+// pages skip re-downloading anything unchanged.
+func DefaultConfig() *Config {
+	conf := &Config{
+		IdleTimeout: 30 * time.Second,
+		MaxPages:    2000,
+		UserAgent:   utils.UserAgent,
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		conf.CacheDir = filepath.Join(dir, "amass", "webcache")
+	}
+	return conf
+}
+
+// Crawler fetches pages reachable from a set of seed URLs and reports the
+// subdomain names it discovers along the way.
+type Crawler struct {
+	conf    *Config
+	robots  *robotsCache
+	limits  *hostLimiter
+	quit    <-chan struct{}
+	domain  string
+
+	mu      sync.Mutex
+	filter  map[string]struct{}
+	names   []string
+	fetched int
+}
+
+// New returns a Crawler that restricts discovered names to the given
+// domain. quit, when closed, aborts the crawl early (e.g. the owning
+// core.Service is shutting down).
+func New(conf *Config, domain string, quit <-chan struct{}) *Crawler {
+	if conf == nil {
+		conf = DefaultConfig()
+	}
+	return &Crawler{
+		conf:   conf,
+		robots: newRobotsCache(conf.UserAgent),
+		limits: newHostLimiter(),
+		quit:   quit,
+		domain: domain,
+		filter: make(map[string]struct{}),
+	}
+}
+
+// transport returns the RoundTripper pages should be fetched through: a
+// plain http.DefaultTransport, or one wrapped in a WebCache when the
+// Crawler was configured with a CacheDir.
+func (c *Crawler) transport() http.RoundTripper {
+	if c.conf.CacheDir == "" {
+		return http.DefaultTransport
+	}
+	cache, err := utils.NewWebCache(c.conf.CacheDir)
+	if err != nil {
+		return http.DefaultTransport
+	}
+	return cache.Transport(http.DefaultTransport)
+}
+
+// Crawl fetches base and every sitemap/page reachable from it, returning
+// the subdomains of domain discovered in links, scripts, srcsets, and
+// inline JS string literals.
+func (c *Crawler) Crawl(base string) ([]string, error) {
+	links := make(chan string, 256)
+	names := make(chan string, 256)
+
+	mux := fetchbot.NewMux()
+	mux.HandleErrors(fetchbot.HandlerFunc(func(ctx *fetchbot.Context, res *http.Response, err error) {
+		if err != nil {
+			c.limits.recordFailure(ctx.Cmd.URL().Host)
+		}
+	}))
+	mux.Response().Method("GET").Handler(fetchbot.HandlerFunc(
+		func(ctx *fetchbot.Context, res *http.Response, err error) {
+			c.handleResponse(ctx, res, links, names)
+		}))
+
+	f := fetchbot.New(fetchbot.HandlerFunc(func(ctx *fetchbot.Context, res *http.Response, err error) {
+		mux.Handle(ctx, res, err)
+	}))
+	f.HttpClient = &http.Client{Timeout: 15 * time.Second, Transport: c.transport()}
+	f.UserAgent = c.conf.UserAgent
+	// Politeness (robots.txt, per-host crawl delay and concurrency) is
+	// handled entirely by robotsCache/hostLimiter in enqueue, which ramps
+	// concurrency per host instead of fetchbot's fixed single-worker-per-host
+	// default. Disable fetchbot's own politeness so it doesn't double-fetch
+	// robots.txt and silently cap every host back down to one in flight.
+	f.DisablePoliteness = true
+
+	q := f.Start()
+	for _, seed := range c.seeds(base) {
+		c.enqueue(q, seed)
+	}
+
+	idle := time.NewTimer(c.conf.IdleTimeout)
+	defer idle.Stop()
+
+loop:
+	for {
+		select {
+		case l := <-links:
+			if c.enqueue(q, l) {
+				idle.Reset(c.conf.IdleTimeout)
+			}
+		case n := <-names:
+			c.mu.Lock()
+			c.names = utils.UniqueAppend(c.names, n)
+			c.mu.Unlock()
+		case <-idle.C:
+			go q.Cancel()
+		case <-c.quit:
+			go q.Cancel()
+		case <-q.Done():
+			break loop
+		}
+	}
+	return c.names, nil
+}
+
+// seeds returns base plus every URL discovered via robots.txt and
+// sitemap.xml (including sitemap indexes and gzipped sitemaps) for base's
+// host.
+func (c *Crawler) seeds(base string) []string {
+	seeds := []string{base}
+
+	rules := c.robots.get(base)
+	for _, sm := range rules.Sitemaps {
+		seeds = append(seeds, fetchSitemapURLs(sm)...)
+	}
+	seeds = append(seeds, fetchSitemapURLs(defaultSitemapURL(base))...)
+	return seeds
+}
+
+// enqueue honors robots.txt Disallow rules and admits u into the crawl's
+// page budget, then dispatches the actual GET in its own goroutine gated by
+// the host's adaptive concurrency/rate limit budget. Gating happens off of
+// the shared dispatch loop in Crawl so that one host backed off to its
+// slowest spacing cannot stall fetches to every other host. The return
+// value reports only whether u was admitted (queued for fetch), not
+// whether the fetch itself later succeeds.
+func (c *Crawler) enqueue(q *fetchbot.Queue, u string) bool {
+	c.mu.Lock()
+	if _, found := c.filter[u]; found {
+		c.mu.Unlock()
+		return false
+	}
+	if c.fetched >= c.conf.MaxPages {
+		c.mu.Unlock()
+		return false
+	}
+	c.filter[u] = struct{}{}
+	c.fetched++
+	c.mu.Unlock()
+
+	if !c.robots.allowed(u) {
+		return false
+	}
+
+	host := hostOf(u)
+	delay := c.robots.crawlDelay(u)
+
+	go func() {
+		release := c.limits.acquire(host, delay)
+		defer release()
+
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+		q.SendStringGet(u)
+	}()
+	return true
+}
+
+func (c *Crawler) handleResponse(ctx *fetchbot.Context, res *http.Response, links, names chan<- string) {
+	host := ctx.Cmd.URL().Host
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		c.limits.backoff(host)
+		return
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		c.limits.rampUp(host)
+	}
+
+	ct := res.Header.Get("Content-Type")
+	if res.StatusCode != http.StatusOK || ct == "" {
+		return
+	}
+	if !isHTML(ct) {
+		return
+	}
+
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return
+	}
+	extractFromDocument(c.domain, ctx.Cmd.URL(), doc, links, names)
+}
+
+func isHTML(contentType string) bool {
+	return len(contentType) >= 9 && contentType[:9] == "text/html"
+}
+
+func hostOf(rawurl string) string {
+	if req, err := http.NewRequest("GET", rawurl, nil); err == nil {
+		return req.URL.Host
+	}
+	return ""
+}
+
+func defaultSitemapURL(base string) string {
+	if req, err := http.NewRequest("GET", base, nil); err == nil {
+		return req.URL.Scheme + "://" + req.URL.Host + "/sitemap.xml"
+	}
+	return ""
+}
+
+// etldPlusOne returns the effective TLD+1 for host, used to key the
+// per-host token bucket so www/api/cdn subdomains of the same site share a
+// single rate limit budget.
+func etldPlusOne(host string) string {
+	etld, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return etld
+}
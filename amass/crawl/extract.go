@@ -0,0 +1,88 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package crawl
+
+import (
+	"net/url"
+	"regexp"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/lanzay/amass/amass/utils"
+)
+
+// jsStringLiteralRE pulls out quoted string literals from inline <script>
+// bodies so they can be scanned for subdomains the same as any other text.
+var jsStringLiteralRE = regexp.MustCompile(`["'` + "`" + `]([^"'` + "`" + `]{1,255})["'` + "`" + `]`)
+
+// extractFromDocument walks doc for subdomains of domain, pulling candidate
+// strings from href/src/srcset attributes and from string literals inside
+// inline <script> bodies; the page's rendered text is not scanned. Links
+// found via href/src/srcset that match domain are also queued for further
+// crawling.
+func extractFromDocument(domain string, pageURL *url.URL, doc *goquery.Document, links, names chan<- string) {
+	re := utils.SubdomainRegex(domain)
+	if re == nil {
+		return
+	}
+
+	emit := func(s string) {
+		if sub := re.FindString(s); sub != "" {
+			names <- sub
+		}
+	}
+
+	doc.Find("a[href], link[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		resolveAndEmit(pageURL, href, re, links, names)
+	})
+
+	doc.Find("script[src], img[src]").Each(func(_ int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		resolveAndEmit(pageURL, src, re, links, names)
+	})
+
+	doc.Find("[srcset]").Each(func(_ int, s *goquery.Selection) {
+		srcset, _ := s.Attr("srcset")
+		for _, candidate := range splitSrcset(srcset) {
+			resolveAndEmit(pageURL, candidate, re, links, names)
+		}
+	})
+
+	doc.Find("script").Not("[src]").Each(func(_ int, s *goquery.Selection) {
+		for _, m := range jsStringLiteralRE.FindAllStringSubmatch(s.Text(), -1) {
+			emit(m[1])
+		}
+	})
+}
+
+func resolveAndEmit(pageURL *url.URL, ref string, re *regexp.Regexp, links, names chan<- string) {
+	if ref == "" {
+		return
+	}
+	if sub := re.FindString(ref); sub != "" {
+		names <- sub
+	}
+
+	u, err := pageURL.Parse(ref)
+	if err != nil {
+		return
+	}
+	if re.FindString(u.String()) != "" {
+		links <- u.String()
+	}
+}
+
+// splitSrcset breaks a srcset attribute value ("a.png 1x, b.png 2x") into
+// its individual candidate URLs.
+func splitSrcset(srcset string) []string {
+	var urls []string
+
+	for _, part := range regexp.MustCompile(`\s*,\s*`).Split(srcset, -1) {
+		fields := regexp.MustCompile(`\s+`).Split(part, -1)
+		if len(fields) > 0 && fields[0] != "" {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
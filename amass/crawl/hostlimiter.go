@@ -0,0 +1,127 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package crawl
+
+import (
+	"sync"
+	"time"
+)
+
+// hostLimiter implements adaptive, per-effective-TLD+1 concurrency: each
+// site starts at one request at a time, ramps up on success, and backs off
+// on 429/5xx responses, with a minimum spacing enforced between the starts
+// of consecutive requests to that site.
+//
+// Unlike a global rate limiter, acquiring a host's budget only blocks the
+// goroutine fetching that host — a single site backed off to its slowest
+// spacing does not stall requests to any other host.
+type hostLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*hostBudget
+}
+
+// hostBudget tracks one host's concurrency window, in-flight request
+// count, and minimum spacing between request starts.
+type hostBudget struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	concurrency int
+	active      int
+	minDelay    time.Duration
+	lastStart   time.Time
+}
+
+const (
+	minConcurrency = 1
+	maxConcurrency = 8
+)
+
+func newHostLimiter() *hostLimiter {
+	return &hostLimiter{buckets: make(map[string]*hostBudget)}
+}
+
+func (h *hostLimiter) budget(host string) *hostBudget {
+	key := etldPlusOne(host)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b, found := h.buckets[key]
+	if !found {
+		b = &hostBudget{concurrency: minConcurrency, minDelay: time.Second}
+		b.cond = sync.NewCond(&b.mu)
+		h.buckets[key] = b
+	}
+	return b
+}
+
+// acquire blocks the calling goroutine (never the crawler's shared dispatch
+// loop) until the host has a free concurrency slot and its minimum spacing
+// since the last request start has elapsed, respecting robotsDelay as a
+// floor on that spacing. The returned func must be called to release the
+// slot once the request completes.
+func (h *hostLimiter) acquire(host string, robotsDelay time.Duration) func() {
+	b := h.budget(host)
+
+	b.mu.Lock()
+	for {
+		delay := b.minDelay
+		if robotsDelay > delay {
+			delay = robotsDelay
+		}
+		wait := delay - time.Since(b.lastStart)
+
+		if b.active < b.concurrency && wait <= 0 {
+			b.active++
+			b.lastStart = time.Now()
+			break
+		}
+		if wait > 0 {
+			b.mu.Unlock()
+			time.Sleep(wait)
+			b.mu.Lock()
+			continue
+		}
+		b.cond.Wait()
+	}
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		b.active--
+		b.mu.Unlock()
+		b.cond.Signal()
+	}
+}
+
+// rampUp widens the host's concurrency window after a successful response.
+func (h *hostLimiter) rampUp(host string) {
+	b := h.budget(host)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.concurrency < maxConcurrency {
+		b.concurrency++
+		b.cond.Signal()
+	}
+}
+
+// backoff narrows the host's concurrency window and stretches its spacing
+// after a 429/5xx response.
+func (h *hostLimiter) backoff(host string) {
+	b := h.budget(host)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.concurrency = minConcurrency
+	b.minDelay *= 2
+	if b.minDelay > time.Minute {
+		b.minDelay = time.Minute
+	}
+}
+
+// recordFailure treats a transport-level error the same as a 5xx response.
+func (h *hostLimiter) recordFailure(host string) {
+	h.backoff(host)
+}
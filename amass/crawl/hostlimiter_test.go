@@ -0,0 +1,107 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package crawl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostBudgetRampUp(t *testing.T) {
+	h := newHostLimiter()
+	host := "www.example.com"
+
+	b := h.budget(host)
+	if b.concurrency != minConcurrency {
+		t.Fatalf("initial concurrency = %d, want %d", b.concurrency, minConcurrency)
+	}
+
+	for i := minConcurrency; i < maxConcurrency; i++ {
+		h.rampUp(host)
+	}
+	if b.concurrency != maxConcurrency {
+		t.Fatalf("concurrency after repeated rampUp = %d, want %d", b.concurrency, maxConcurrency)
+	}
+
+	// rampUp should not push concurrency past the configured ceiling.
+	h.rampUp(host)
+	if b.concurrency != maxConcurrency {
+		t.Fatalf("concurrency exceeded maxConcurrency: got %d", b.concurrency)
+	}
+}
+
+func TestHostBudgetBackoff(t *testing.T) {
+	h := newHostLimiter()
+	host := "www.example.com"
+
+	b := h.budget(host)
+	h.rampUp(host)
+	h.rampUp(host)
+	if b.concurrency <= minConcurrency {
+		t.Fatal("expected rampUp to widen concurrency before backoff narrows it")
+	}
+
+	h.backoff(host)
+	if b.concurrency != minConcurrency {
+		t.Fatalf("concurrency after backoff = %d, want %d", b.concurrency, minConcurrency)
+	}
+	if b.minDelay != 2*time.Second {
+		t.Fatalf("minDelay after one backoff = %v, want %v", b.minDelay, 2*time.Second)
+	}
+
+	// minDelay should be capped at one minute no matter how many times the
+	// host keeps backing off.
+	for i := 0; i < 10; i++ {
+		h.backoff(host)
+	}
+	if b.minDelay != time.Minute {
+		t.Fatalf("minDelay after repeated backoff = %v, want %v", b.minDelay, time.Minute)
+	}
+}
+
+func TestHostBudgetAcquireRelease(t *testing.T) {
+	h := newHostLimiter()
+	host := "www.example.com"
+
+	release := h.acquire(host, 0)
+
+	b := h.budget(host)
+	b.mu.Lock()
+	active := b.active
+	b.mu.Unlock()
+	if active != 1 {
+		t.Fatalf("active after acquire = %d, want 1", active)
+	}
+
+	release()
+
+	b.mu.Lock()
+	active = b.active
+	b.mu.Unlock()
+	if active != 0 {
+		t.Fatalf("active after release = %d, want 0", active)
+	}
+}
+
+func TestHostBudgetAcquireRespectsRobotsDelay(t *testing.T) {
+	h := newHostLimiter()
+	host := "slow.example.com"
+
+	release := h.acquire(host, 0)
+	release()
+
+	// Isolate the robotsDelay floor from the budget's own default spacing,
+	// which would otherwise dominate the wait and make the test slow.
+	b := h.budget(host)
+	b.mu.Lock()
+	b.minDelay = 0
+	b.mu.Unlock()
+
+	start := time.Now()
+	release = h.acquire(host, 50*time.Millisecond)
+	release()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("acquire returned after %v, want at least the robots crawl-delay of 50ms", elapsed)
+	}
+}
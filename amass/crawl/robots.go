@@ -0,0 +1,97 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package crawl
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+// robotsCache fetches and caches robots.txt per host, so repeated lookups
+// against the same host within a crawl do not trigger repeated fetches.
+type robotsCache struct {
+	userAgent string
+
+	mu    sync.Mutex
+	cache map[string]*robotstxt.RobotsData
+}
+
+func newRobotsCache(userAgent string) *robotsCache {
+	return &robotsCache{
+		userAgent: userAgent,
+		cache:     make(map[string]*robotstxt.RobotsData),
+	}
+}
+
+// get returns the parsed robots.txt for rawurl's host, fetching it on
+// first use. A fetch failure yields a permissive RobotsData so the crawl
+// is not blocked by a host with no robots.txt.
+func (c *robotsCache) get(rawurl string) *robotstxt.RobotsData {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return permissiveRobots()
+	}
+
+	key := req.URL.Scheme + "://" + req.URL.Host
+	c.mu.Lock()
+	if rules, found := c.cache[key]; found {
+		c.mu.Unlock()
+		return rules
+	}
+	c.mu.Unlock()
+
+	rules := c.fetch(key)
+	c.mu.Lock()
+	c.cache[key] = rules
+	c.mu.Unlock()
+	return rules
+}
+
+func (c *robotsCache) fetch(origin string) *robotstxt.RobotsData {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(origin + "/robots.txt")
+	if err != nil {
+		return permissiveRobots()
+	}
+	defer resp.Body.Close()
+
+	rules, err := robotstxt.FromResponse(resp)
+	if err != nil {
+		return permissiveRobots()
+	}
+	return rules
+}
+
+func permissiveRobots() *robotstxt.RobotsData {
+	rules, _ := robotstxt.FromStatusAndString(http.StatusNotFound, "")
+	return rules
+}
+
+// allowed reports whether the crawler's user agent may fetch rawurl.
+func (c *robotsCache) allowed(rawurl string) bool {
+	rules := c.get(rawurl)
+	if rules == nil {
+		return true
+	}
+	// Group.Test matches rules against the request path, not a full URL.
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return true
+	}
+	return rules.FindGroup(c.userAgent).Test(u.RequestURI())
+}
+
+// crawlDelay returns the Crawl-delay directive for rawurl's host, or zero
+// when the host declares none.
+func (c *robotsCache) crawlDelay(rawurl string) time.Duration {
+	rules := c.get(rawurl)
+	if rules == nil {
+		return 0
+	}
+	return rules.FindGroup(c.userAgent).CrawlDelay
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package crawl
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sitemapIndex is the root element of a sitemap index file, which points at
+// further per-section sitemaps instead of listing pages directly.
+type sitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+// urlSet is the root element of a plain sitemap file.
+type urlSet struct {
+	XMLName xml.Name       `xml:"urlset"`
+	URLs    []sitemapEntry `xml:"url"`
+}
+
+type sitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+// fetchSitemapURLs downloads sitemapURL, transparently gunzipping it when
+// served (or named) as gzip, and returns every page URL it lists. Sitemap
+// indexes are followed recursively: fetchSitemapURLs calls itself for each
+// sitemap an index lists and returns the combined page URLs.
+func fetchSitemapURLs(sitemapURL string) []string {
+	if sitemapURL == "" {
+		return nil
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(sitemapURL)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	var reader io.Reader = resp.Body
+	if strings.HasSuffix(sitemapURL, ".gz") || resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil
+	}
+
+	var index sitemapIndex
+	if xml.Unmarshal(raw, &index) == nil && len(index.Sitemaps) > 0 {
+		var urls []string
+		for _, s := range index.Sitemaps {
+			urls = append(urls, fetchSitemapURLs(s.Loc)...)
+		}
+		return urls
+	}
+
+	var set urlSet
+	if xml.Unmarshal(raw, &set) != nil {
+		return nil
+	}
+
+	var urls []string
+	for _, u := range set.URLs {
+		urls = append(urls, u.Loc)
+	}
+	return urls
+}
@@ -0,0 +1,360 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package async implements a massdns/ksubdomain-style stateless DNS
+// brute-forcer: a single raw socket (or small fixed pool) sends queries as
+// fast as the upstream resolvers allow, while a dedicated reader goroutine
+// demultiplexes replies against an in-memory table of outstanding queries.
+// It is meant to sit behind a core.Service so Amass's brute-force and
+// alteration modes can resolve names far faster than one net.Resolver
+// lookup at a time allows.
+package async
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Result is emitted on the Engine's output channel for every name submitted,
+// once it has been answered, exhausted its retries, or timed out.
+type Result struct {
+	Name  string
+	IPs   []net.IP
+	Rcode int
+	Err   error
+}
+
+// Config tunes an Engine.
+type Config struct {
+	// Resolvers is the list of upstream server addresses (host:port) to
+	// distribute queries across.
+	Resolvers []string
+	// QPS is the aggregate target queries-per-second across all resolvers.
+	QPS int
+	// Retries bounds how many times a lost query is resent before it is
+	// reported back with Rcode == dns.RcodeServerFailure.
+	Retries int
+	// Timeout is how long a query waits for a reply before it is retried.
+	Timeout time.Duration
+	// MaxServfailRatio blacklists a resolver once this fraction of its
+	// recent queries have ended in SERVFAIL or timeout.
+	MaxServfailRatio float64
+}
+
+// DefaultConfig returns sane defaults for Config.
+func DefaultConfig() *Config {
+	return &Config{
+		QPS:              10000,
+		Retries:          3,
+		Timeout:          2 * time.Second,
+		MaxServfailRatio: 0.5,
+	}
+}
+
+// Engine is the stateless brute-force resolution engine. Names submitted on
+// In are resolved against the configured resolvers and their results are
+// emitted on Out.
+type Engine struct {
+	In  chan string
+	Out chan Result
+
+	conf      *Config
+	conn      *net.UDPConn
+	resolvers []*resolverState
+	rrLock    sync.Mutex
+	rrNext    int
+	shards    []*shard
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// pendingQuery tracks one in-flight query for retry/timeout bookkeeping.
+type pendingQuery struct {
+	name     string
+	qtype    uint16
+	txid     uint16
+	resolver *resolverState
+	attempts int
+	sentAt   time.Time
+}
+
+// shard is one bucket of the sharded pending-query table, keyed by txid so
+// the reader goroutine can demux replies without a single global lock.
+type shard struct {
+	sync.Mutex
+	pending map[uint16]*pendingQuery
+}
+
+const numShards = 256
+
+func shardFor(txid uint16) int {
+	return int(txid % numShards)
+}
+
+// New creates an Engine bound to a single UDP socket shared by every
+// outstanding query, with randomized source port selection handled by the
+// kernel (net.ListenUDP with port 0).
+func New(conf *Config) (*Engine, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: 0})
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Engine{
+		In:   make(chan string, 1000),
+		Out:  make(chan Result, 1000),
+		conf: conf,
+		conn: conn,
+		done: make(chan struct{}),
+	}
+	e.shards = make([]*shard, numShards)
+	for i := range e.shards {
+		e.shards[i] = &shard{pending: make(map[uint16]*pendingQuery)}
+	}
+	for _, addr := range conf.Resolvers {
+		e.resolvers = append(e.resolvers, newResolverState(addr, conf.QPS/max(1, len(conf.Resolvers))))
+	}
+
+	e.wg.Add(3)
+	go e.reader()
+	go e.writer()
+	go e.retryLoop()
+	return e, nil
+}
+
+// Stop shuts the engine down, releases its socket, and stops every
+// resolver's token bucket ticker/goroutine.
+func (e *Engine) Stop() {
+	close(e.done)
+	e.conn.Close()
+	e.wg.Wait()
+
+	for _, r := range e.resolvers {
+		r.Stop()
+	}
+}
+
+// writer pulls names off In, assigns a txid, and sends the query to the
+// next healthy resolver permitted by its token bucket.
+func (e *Engine) writer() {
+	defer e.wg.Done()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case name, ok := <-e.In:
+			if !ok {
+				return
+			}
+			e.send(name, dns.TypeA, 1)
+		}
+	}
+}
+
+func (e *Engine) send(name string, qtype uint16, attempt int) {
+	res := e.pickResolver()
+	if res == nil {
+		e.Out <- Result{Name: name, Err: errNoHealthyResolvers}
+		return
+	}
+	res.bucket.Wait()
+
+	q := &pendingQuery{name: name, qtype: qtype, resolver: res, attempts: attempt, sentAt: time.Now()}
+	// Pick a txid not already held by an outstanding query, so one query
+	// never overwrites another in the pending table.
+	for {
+		id := uint16(rand.Intn(1 << 16))
+		sh := e.shards[shardFor(id)]
+		sh.Lock()
+		if _, used := sh.pending[id]; !used {
+			q.txid = id
+			sh.pending[id] = q
+			sh.Unlock()
+			break
+		}
+		sh.Unlock()
+	}
+	txid := q.txid
+
+	msg := new(dns.Msg)
+	msg.Id = txid
+	msg.RecursionDesired = true
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+
+	packed, err := msg.Pack()
+	if err != nil {
+		e.dropPending(txid)
+		e.Out <- Result{Name: name, Err: err}
+		return
+	}
+	if _, err := e.conn.WriteToUDP(packed, res.addr); err != nil {
+		e.dropPending(txid)
+		e.Out <- Result{Name: name, Err: err}
+	}
+}
+
+func (e *Engine) dropPending(txid uint16) *pendingQuery {
+	sh := e.shards[shardFor(txid)]
+	sh.Lock()
+	defer sh.Unlock()
+
+	q := sh.pending[txid]
+	delete(sh.pending, txid)
+	return q
+}
+
+// reader demultiplexes UDP replies against the sharded pending table, which
+// is keyed by txid alone; a reply is matched only if its question name also
+// equals the pending query's name. It falls back to TCP when a reply is
+// truncated.
+func (e *Engine) reader() {
+	defer e.wg.Done()
+
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := e.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-e.done:
+				return
+			default:
+				continue
+			}
+		}
+
+		msg := new(dns.Msg)
+		if err := msg.Unpack(buf[:n]); err != nil {
+			continue
+		}
+
+		if len(msg.Question) == 0 {
+			continue
+		}
+		sh := e.shards[shardFor(msg.Id)]
+		sh.Lock()
+		q := sh.pending[msg.Id]
+		if q == nil || !sameName(q.name, msg.Question[0].Name) {
+			sh.Unlock()
+			continue
+		}
+		delete(sh.pending, msg.Id)
+		sh.Unlock()
+		q.resolver.recordOutcome(msg.Rcode == dns.RcodeServerFailure)
+
+		if msg.Truncated {
+			go e.resolveTCP(q)
+			continue
+		}
+		e.Out <- Result{Name: q.name, IPs: msgToIPs(msg), Rcode: msg.Rcode}
+	}
+}
+
+func (e *Engine) resolveTCP(q *pendingQuery) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(q.name), q.qtype)
+
+	client := &dns.Client{Net: "tcp", Timeout: e.conf.Timeout}
+	resp, _, err := client.Exchange(msg, q.resolver.addr.String())
+	if err != nil {
+		e.Out <- Result{Name: q.name, Err: err}
+		return
+	}
+	e.Out <- Result{Name: q.name, IPs: msgToIPs(resp), Rcode: resp.Rcode}
+}
+
+// retryLoop periodically sweeps the pending table for queries that have
+// aged past the configured timeout, resending with exponential backoff up
+// to conf.Retries times before giving up.
+func (e *Engine) retryLoop() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.conf.Timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+			e.sweepExpired()
+		}
+	}
+}
+
+func (e *Engine) sweepExpired() {
+	now := time.Now()
+	for _, sh := range e.shards {
+		sh.Lock()
+		var expired []*pendingQuery
+		for txid, q := range sh.pending {
+			backoff := e.conf.Timeout * time.Duration(1<<uint(q.attempts-1))
+			if now.Sub(q.sentAt) >= backoff {
+				expired = append(expired, q)
+				delete(sh.pending, txid)
+			}
+		}
+		sh.Unlock()
+
+		for _, q := range expired {
+			q.resolver.recordOutcome(true)
+			if q.attempts > e.conf.Retries {
+				e.Out <- Result{Name: q.name, Rcode: dns.RcodeServerFailure, Err: errRetriesExhausted}
+				continue
+			}
+			e.send(q.name, q.qtype, q.attempts+1)
+		}
+	}
+}
+
+// pickResolver round-robins across every configured resolver, skipping any
+// currently blacklisted one, so aggregate throughput scales with the whole
+// resolver list instead of being capped by a single resolver's token bucket.
+func (e *Engine) pickResolver() *resolverState {
+	n := len(e.resolvers)
+	if n == 0 {
+		return nil
+	}
+
+	e.rrLock.Lock()
+	start := e.rrNext
+	e.rrNext = (e.rrNext + 1) % n
+	e.rrLock.Unlock()
+
+	for i := 0; i < n; i++ {
+		r := e.resolvers[(start+i)%n]
+		if !r.blacklisted(e.conf.MaxServfailRatio) {
+			return r
+		}
+	}
+	return nil
+}
+
+func sameName(want, got string) bool {
+	return dns.Fqdn(want) == got
+}
+
+func msgToIPs(msg *dns.Msg) []net.IP {
+	var ips []net.IP
+
+	for _, rr := range msg.Answer {
+		switch v := rr.(type) {
+		case *dns.A:
+			ips = append(ips, v.A)
+		case *dns.AAAA:
+			ips = append(ips, v.AAAA)
+		}
+	}
+	return ips
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
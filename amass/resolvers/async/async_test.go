@@ -0,0 +1,224 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package async
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestPickResolverRoundRobinSkipsBlacklisted(t *testing.T) {
+	a := newResolverState("127.0.0.1:1", 1000)
+	b := newResolverState("127.0.0.1:2", 1000)
+	c := newResolverState("127.0.0.1:3", 1000)
+	defer a.Stop()
+	defer b.Stop()
+	defer c.Stop()
+
+	// Blacklist b by pushing an all-failure window.
+	for i := 0; i < windowSize; i++ {
+		b.recordOutcome(true)
+	}
+
+	e := &Engine{
+		conf:      &Config{MaxServfailRatio: 0.5},
+		resolvers: []*resolverState{a, b, c},
+	}
+
+	var picked []*resolverState
+	for i := 0; i < 4; i++ {
+		picked = append(picked, e.pickResolver())
+	}
+	for _, r := range picked {
+		if r == b {
+			t.Fatal("pickResolver returned a blacklisted resolver")
+		}
+	}
+	// With b skipped, b's turn falls through to c, so the first two picks
+	// are a then c.
+	if picked[0] == picked[1] {
+		t.Errorf("pickResolver did not rotate across healthy resolvers: got %v then %v", picked[0].addr, picked[1].addr)
+	}
+}
+
+func TestPickResolverNoneHealthy(t *testing.T) {
+	e := &Engine{conf: &Config{}}
+	if r := e.pickResolver(); r != nil {
+		t.Fatalf("pickResolver on an empty resolver list should return nil, got %v", r)
+	}
+}
+
+// fakeUDPServer plays back a single canned DNS reply (as if replaying a
+// captured packet) for every query it receives on laddr, until stop is
+// closed.
+func fakeUDPServer(t *testing.T, conn *net.UDPConn, reply func(q *dns.Msg) *dns.Msg, stop <-chan struct{}) {
+	t.Helper()
+
+	buf := make([]byte, 65535)
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-stop:
+				return
+			default:
+				continue
+			}
+		}
+
+		q := new(dns.Msg)
+		if err := q.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		resp := reply(q)
+		packed, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+		conn.WriteToUDP(packed, addr)
+	}
+}
+
+// TestEngineResolveUDP exercises the full query/response wire path: a fake
+// authoritative server replays a crafted A-record answer, and the Engine is
+// expected to demux it back to the right name via the sharded pending table.
+func TestEngineResolveUDP(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to start fake resolver: %v", err)
+	}
+	defer server.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go fakeUDPServer(t, server, func(q *dns.Msg) *dns.Msg {
+		resp := new(dns.Msg)
+		resp.SetReply(q)
+		if len(q.Question) > 0 {
+			resp.Answer = append(resp.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.ParseIP("203.0.113.10"),
+			})
+		}
+		return resp
+	}, stop)
+
+	conf := DefaultConfig()
+	conf.Resolvers = []string{server.LocalAddr().String()}
+	conf.Timeout = time.Second
+
+	e, err := New(conf)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	defer e.Stop()
+
+	e.In <- "www.example.com"
+
+	select {
+	case res := <-e.Out:
+		if res.Err != nil {
+			t.Fatalf("unexpected error in result: %v", res.Err)
+		}
+		if len(res.IPs) != 1 || !res.IPs[0].Equal(net.ParseIP("203.0.113.10")) {
+			t.Fatalf("IPs = %v, want [203.0.113.10]", res.IPs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for resolution result")
+	}
+}
+
+// TestEngineTruncatedFallsBackToTCP confirms a truncated UDP reply causes the
+// engine to retry the query over TCP rather than reporting a partial answer.
+func TestEngineTruncatedFallsBackToTCP(t *testing.T) {
+	udpServer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to start fake UDP resolver: %v", err)
+	}
+	defer udpServer.Close()
+
+	tcpServer, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: udpServer.LocalAddr().(*net.UDPAddr).Port})
+	if err != nil {
+		t.Fatalf("failed to start fake TCP resolver: %v", err)
+	}
+	defer tcpServer.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go fakeUDPServer(t, udpServer, func(q *dns.Msg) *dns.Msg {
+		resp := new(dns.Msg)
+		resp.SetReply(q)
+		resp.Truncated = true
+		return resp
+	}, stop)
+
+	go func() {
+		for {
+			conn, err := tcpServer.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				lenBuf := make([]byte, 2)
+				if _, err := conn.Read(lenBuf); err != nil {
+					return
+				}
+				msgBuf := make([]byte, binary.BigEndian.Uint16(lenBuf))
+				if _, err := conn.Read(msgBuf); err != nil {
+					return
+				}
+				q := new(dns.Msg)
+				if err := q.Unpack(msgBuf); err != nil {
+					return
+				}
+
+				resp := new(dns.Msg)
+				resp.SetReply(q)
+				resp.Answer = append(resp.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: q.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+					A:   net.ParseIP("198.51.100.20"),
+				})
+				packed, err := resp.Pack()
+				if err != nil {
+					return
+				}
+				out := make([]byte, 2+len(packed))
+				binary.BigEndian.PutUint16(out, uint16(len(packed)))
+				copy(out[2:], packed)
+				conn.Write(out)
+			}()
+		}
+	}()
+
+	conf := DefaultConfig()
+	conf.Resolvers = []string{udpServer.LocalAddr().String()}
+	conf.Timeout = time.Second
+
+	e, err := New(conf)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	defer e.Stop()
+
+	e.In <- "truncated.example.com"
+
+	select {
+	case res := <-e.Out:
+		if res.Err != nil {
+			t.Fatalf("unexpected error in result: %v", res.Err)
+		}
+		if len(res.IPs) != 1 || !res.IPs[0].Equal(net.ParseIP("198.51.100.20")) {
+			t.Fatalf("IPs = %v, want [198.51.100.20] (from the TCP fallback)", res.IPs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the TCP fallback resolution")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package async
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	errNoHealthyResolvers = errors.New("async: no healthy resolvers available")
+	errRetriesExhausted   = errors.New("async: retries exhausted")
+)
+
+// resolverState tracks per-resolver rate limiting and SERVFAIL/timeout
+// ratio bookkeeping used to blacklist a misbehaving upstream.
+type resolverState struct {
+	addr   *net.UDPAddr
+	bucket *tokenBucket
+
+	sync.Mutex
+	total   int
+	failed  int
+	window  []bool // recent outcomes, true == failure, capped at windowSize
+}
+
+const windowSize = 200
+
+func newResolverState(server string, qps int) *resolverState {
+	addr, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		addr = &net.UDPAddr{IP: net.ParseIP(server), Port: 53}
+	}
+	if qps <= 0 {
+		qps = 1
+	}
+	return &resolverState{
+		addr:   addr,
+		bucket: newTokenBucket(qps),
+	}
+}
+
+// recordOutcome folds the latest query result into the sliding failure
+// window used by blacklisted().
+func (r *resolverState) recordOutcome(failed bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.window = append(r.window, failed)
+	if len(r.window) > windowSize {
+		r.window = r.window[1:]
+	}
+	r.total++
+	if failed {
+		r.failed++
+	}
+}
+
+// Stop releases the resolver's token bucket ticker and goroutine.
+func (r *resolverState) Stop() {
+	r.bucket.Stop()
+}
+
+// blacklisted reports whether this resolver's recent SERVFAIL/timeout ratio
+// exceeds maxRatio. Resolvers are given a grace period (half a window's
+// worth of samples) before they can be blacklisted, so a slow start does
+// not immediately disqualify an otherwise healthy resolver.
+func (r *resolverState) blacklisted(maxRatio float64) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	if len(r.window) < windowSize/2 {
+		return false
+	}
+
+	var failures int
+	for _, f := range r.window {
+		if f {
+			failures++
+		}
+	}
+	return float64(failures)/float64(len(r.window)) > maxRatio
+}
+
+// tokenBucket is a minimal per-resolver rate limiter: it refills to its
+// capacity once per second and Wait blocks until a token is available.
+type tokenBucket struct {
+	sync.Mutex
+	tokens   int
+	capacity int
+	refill   *time.Ticker
+	done     chan struct{}
+}
+
+func newTokenBucket(qps int) *tokenBucket {
+	tb := &tokenBucket{
+		tokens:   qps,
+		capacity: qps,
+		refill:   time.NewTicker(time.Second),
+		done:     make(chan struct{}),
+	}
+	go tb.loop()
+	return tb
+}
+
+func (tb *tokenBucket) loop() {
+	for {
+		select {
+		case <-tb.done:
+			return
+		case <-tb.refill.C:
+			tb.Lock()
+			tb.tokens = tb.capacity
+			tb.Unlock()
+		}
+	}
+}
+
+// Stop halts the refill ticker and its goroutine. It must be called exactly
+// once, when the owning resolverState is no longer in use.
+func (tb *tokenBucket) Stop() {
+	tb.refill.Stop()
+	close(tb.done)
+}
+
+// Wait blocks, spinning on a short sleep, until a token is available. The
+// engine calls this immediately before sending a query, so the sleep
+// granularity only matters under heavy contention on a single resolver.
+func (tb *tokenBucket) Wait() {
+	for {
+		tb.Lock()
+		if tb.tokens > 0 {
+			tb.tokens--
+			tb.Unlock()
+			return
+		}
+		tb.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package async
+
+import "testing"
+
+func TestResolverStateBlacklisted(t *testing.T) {
+	r := newResolverState("127.0.0.1:53", 1000)
+	defer r.Stop()
+
+	// Fewer than windowSize/2 samples: never blacklisted, even at 100% failure.
+	for i := 0; i < windowSize/2-1; i++ {
+		r.recordOutcome(true)
+	}
+	if r.blacklisted(0.5) {
+		t.Fatal("resolver should not be blacklisted before its grace period of samples is reached")
+	}
+
+	// Push the window past the grace period with an all-failure tail.
+	for i := 0; i < windowSize; i++ {
+		r.recordOutcome(true)
+	}
+	if !r.blacklisted(0.5) {
+		t.Fatal("resolver with a 100% failure ratio should be blacklisted at a 0.5 max ratio")
+	}
+}
+
+func TestResolverStateHealthy(t *testing.T) {
+	r := newResolverState("127.0.0.1:53", 1000)
+	defer r.Stop()
+
+	for i := 0; i < windowSize; i++ {
+		r.recordOutcome(i%10 == 0) // 10% failure ratio
+	}
+	if r.blacklisted(0.5) {
+		t.Fatal("a resolver with a 10% failure ratio should not be blacklisted at a 0.5 max ratio")
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	tb := newTokenBucket(2)
+	defer tb.Stop()
+
+	// Draining the initial capacity should not block.
+	tb.Wait()
+	tb.Wait()
+
+	tb.Lock()
+	tokens := tb.tokens
+	tb.Unlock()
+	if tokens != 0 {
+		t.Fatalf("tokens = %d after draining capacity, want 0", tokens)
+	}
+}
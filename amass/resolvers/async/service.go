@@ -0,0 +1,67 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package async
+
+import (
+	"github.com/lanzay/amass/amass/core"
+)
+
+// BruteService wraps an Engine as a core.Service so the brute-force and
+// alteration modes can submit names for resolution the same way they would
+// interact with any other Amass service.
+type BruteService struct {
+	core.BaseService
+
+	engine *Engine
+	config *core.Config
+	bus    *core.EventBus
+}
+
+// NewBruteService returns a BruteService ready to be started. It resolves
+// against the resolvers declared in config; its query rate, retries and
+// timeout are those of DefaultConfig, not values read from config.
+func NewBruteService(config *core.Config, bus *core.EventBus) *BruteService {
+	bs := &BruteService{
+		config: config,
+		bus:    bus,
+	}
+	bs.BaseService = *core.NewBaseService(bs, "Async Brute Forcer")
+	return bs
+}
+
+// Names returns the channel to submit candidate names on for resolution.
+func (bs *BruteService) Names() chan<- string {
+	return bs.engine.In
+}
+
+// OnStart spins up the underlying Engine and a goroutine that forwards its
+// results onto the event bus for consumption by other services.
+func (bs *BruteService) OnStart() error {
+	conf := DefaultConfig()
+	conf.Resolvers = bs.config.Resolvers
+
+	engine, err := New(conf)
+	if err != nil {
+		return err
+	}
+	bs.engine = engine
+
+	go bs.processOutput()
+	return nil
+}
+
+func (bs *BruteService) processOutput() {
+	for result := range bs.engine.Out {
+		if result.Err != nil || len(result.IPs) == 0 {
+			continue
+		}
+		bs.bus.Publish(core.NewNameTopic, result.Name)
+	}
+}
+
+// OnStop releases the Engine's socket and goroutines.
+func (bs *BruteService) OnStop() error {
+	bs.engine.Stop()
+	return nil
+}
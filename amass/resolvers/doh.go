@@ -0,0 +1,242 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolvers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/http2"
+)
+
+const dnsMessageContentType = "application/dns-message"
+
+// DoHResolver implements Resolver using DNS-over-HTTPS (RFC 8484) against a
+// single server endpoint, such as https://1.1.1.1/dns-query.
+type DoHResolver struct {
+	endpoint   *url.URL
+	bootstraps []string
+	client     *http.Client
+
+	sync.Mutex
+	cache map[string]cachedAnswer
+}
+
+type cachedAnswer struct {
+	msg     *dns.Msg
+	expires time.Time
+}
+
+// NewDoHResolver returns a resolver that performs lookups against endpoint
+// (e.g. "https://1.1.1.1/dns-query") over DoH. bootstraps, when provided,
+// are used to resolve the endpoint hostname instead of the system resolver.
+func NewDoHResolver(endpoint string, bootstraps ...string) (*DoHResolver, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &DoHResolver{
+		endpoint:   u,
+		bootstraps: bootstraps,
+		cache:      make(map[string]cachedAnswer),
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:          200,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   20 * time.Second,
+		ExpectContinueTimeout: 20 * time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: false},
+		DialContext:           r.dialContext,
+	}
+	if err := http2.ConfigureTransport(transport); err != nil {
+		return nil, err
+	}
+
+	r.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+	}
+	return r, nil
+}
+
+// dialContext resolves the DoH endpoint host using the bootstrap resolvers
+// before handing the dial off to a normal net.Dialer.
+func (r *DoHResolver) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, "443"
+	}
+
+	ip, err := bootstrapLookup(ctx, host, r.bootstraps)
+	if err != nil {
+		return nil, err
+	}
+
+	d := net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	return d.DialContext(ctx, network, net.JoinHostPort(ip, port))
+}
+
+// Resolve performs a DoH lookup, preferring a cached answer whose
+// Cache-Control max-age has not yet elapsed.
+func (r *DoHResolver) Resolve(ctx context.Context, name string, qtype uint16) ([]net.IP, error) {
+	key := name + "|" + strconv.Itoa(int(qtype))
+
+	r.Lock()
+	if c, found := r.cache[key]; found && time.Now().Before(c.expires) {
+		r.Unlock()
+		return msgToIPs(c.msg), nil
+	}
+	r.Unlock()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	// Suppress EDNS0 client subnet so resolvers do not tailor answers to
+	// the requester's network location.
+	msg.SetEdns0(4096, false)
+
+	resp, maxAge, err := r.exchange(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxAge > 0 {
+		r.Lock()
+		r.cache[key] = cachedAnswer{msg: resp, expires: time.Now().Add(maxAge)}
+		r.Unlock()
+	}
+	return msgToIPs(resp), nil
+}
+
+// exchange performs the wire transfer, preferring POST with the standard
+// application/dns-message body and falling back to the GET form using the
+// base64url "dns" query parameter for servers that require it.
+func (r *DoHResolver) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, time.Duration, error) {
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest("POST", r.endpoint.String(), bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", dnsMessageContentType)
+	req.Header.Set("Accept", dnsMessageContentType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return r.exchangeGET(ctx, packed)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	answer := new(dns.Msg)
+	if err := answer.Unpack(body); err != nil {
+		return nil, 0, err
+	}
+	return answer, maxAgeFromHeader(resp.Header.Get("Cache-Control")), nil
+}
+
+func (r *DoHResolver) exchangeGET(ctx context.Context, packed []byte) (*dns.Msg, time.Duration, error) {
+	q := base64.RawURLEncoding.EncodeToString(packed)
+
+	u := *r.endpoint
+	values := u.Query()
+	values.Set("dns", q)
+	u.RawQuery = values.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", dnsMessageContentType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, errors.New("doh: " + resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	answer := new(dns.Msg)
+	if err := answer.Unpack(body); err != nil {
+		return nil, 0, err
+	}
+	return answer, maxAgeFromHeader(resp.Header.Get("Cache-Control")), nil
+}
+
+// maxAgeFromHeader extracts the max-age directive from a Cache-Control
+// header value, returning zero when absent or malformed.
+func maxAgeFromHeader(cc string) time.Duration {
+	for _, part := range strings.Split(cc, ",") {
+		part = strings.TrimSpace(part)
+		if !strings.HasPrefix(part, "max-age=") {
+			continue
+		}
+		if secs, err := strconv.Atoi(strings.TrimPrefix(part, "max-age=")); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return 0
+}
+
+func msgToIPs(msg *dns.Msg) []net.IP {
+	var ips []net.IP
+
+	if msg == nil {
+		return ips
+	}
+	for _, rr := range msg.Answer {
+		switch v := rr.(type) {
+		case *dns.A:
+			ips = append(ips, v.A)
+		case *dns.AAAA:
+			ips = append(ips, v.AAAA)
+		}
+	}
+	return ips
+}
+
+// Stop closes idle connections held by the underlying HTTP client.
+func (r *DoHResolver) Stop() {
+	r.client.CloseIdleConnections()
+}
+
+// String returns the DoH endpoint URL.
+func (r *DoHResolver) String() string {
+	return r.endpoint.String()
+}
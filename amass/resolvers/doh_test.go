@@ -0,0 +1,54 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolvers
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestMaxAgeFromHeader(t *testing.T) {
+	tests := []struct {
+		cc   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"no-cache", 0},
+		{"max-age=0", 0},
+		{"max-age=300", 300 * time.Second},
+		{"private, max-age=60", 60 * time.Second},
+		{"max-age=not-a-number", 0},
+	}
+
+	for _, tt := range tests {
+		if got := maxAgeFromHeader(tt.cc); got != tt.want {
+			t.Errorf("maxAgeFromHeader(%q) = %v, want %v", tt.cc, got, tt.want)
+		}
+	}
+}
+
+func TestMsgToIPs(t *testing.T) {
+	if ips := msgToIPs(nil); ips != nil {
+		t.Fatalf("msgToIPs(nil) = %v, want nil", ips)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	msg.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET}, A: net.ParseIP("93.184.216.34")},
+		&dns.AAAA{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET}, AAAA: net.ParseIP("2606:2800:220:1:248:1893:25c8:1946")},
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET}, Target: "other.example.com."},
+	}
+
+	ips := msgToIPs(msg)
+	if len(ips) != 2 {
+		t.Fatalf("msgToIPs() returned %d IPs, want 2 (CNAME should be ignored): %v", len(ips), ips)
+	}
+	if !ips[0].Equal(net.ParseIP("93.184.216.34")) {
+		t.Errorf("ips[0] = %v, want 93.184.216.34", ips[0])
+	}
+}
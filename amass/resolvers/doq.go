@@ -0,0 +1,177 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolvers
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/miekg/dns"
+)
+
+// doqALPN is the ALPN token DoQ servers negotiate (RFC 9250).
+var doqALPN = []string{"doq"}
+
+// DoQResolver implements Resolver using DNS-over-QUIC (RFC 9250) against a
+// single server, such as quic://dns.adguard.com.
+type DoQResolver struct {
+	host       string
+	port       string
+	bootstraps []string
+
+	sync.Mutex
+	session quic.Connection
+}
+
+// NewDoQResolver returns a resolver that performs lookups against server
+// (host, or host:port, with an optional "quic://" scheme) over DoQ.
+func NewDoQResolver(server string, bootstraps ...string) (*DoQResolver, error) {
+	server = strings.TrimPrefix(server, "quic://")
+
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = server, "853"
+	}
+
+	return &DoQResolver{
+		host:       host,
+		port:       port,
+		bootstraps: bootstraps,
+	}, nil
+}
+
+// Resolve opens a new QUIC stream on the (possibly cached) session and
+// performs a single query/response exchange, retrying once on a fresh
+// session if the existing one was closed out from under us.
+func (r *DoQResolver) Resolve(ctx context.Context, name string, qtype uint16) ([]net.IP, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.Id = 0 // RFC 9250 requires the message ID to be zero on the wire
+	// Suppress EDNS0 client subnet so resolvers do not tailor answers to
+	// the requester's network location.
+	msg.SetEdns0(4096, false)
+
+	answer, err := r.exchange(ctx, msg)
+	if err != nil && isIdempotentRetry(err) {
+		r.Lock()
+		r.session = nil
+		r.Unlock()
+		answer, err = r.exchange(ctx, msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msgToIPs(answer), nil
+}
+
+// isIdempotentRetry reports whether err indicates the peer closed the
+// connection/stream (application error 0x5, DoQNoError's successor in some
+// server implementations, or a generic closed-session error), in which case
+// the query is safe to retry against a fresh session.
+func isIdempotentRetry(err error) bool {
+	var appErr *quic.ApplicationError
+	if ok := (func() bool {
+		e, ok := err.(*quic.ApplicationError)
+		if ok {
+			appErr = e
+		}
+		return ok
+	})(); ok {
+		return appErr.ErrorCode == 0x5
+	}
+	return strings.Contains(err.Error(), "closed")
+}
+
+func (r *DoQResolver) getSession(ctx context.Context) (quic.Connection, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.session != nil {
+		return r.session, nil
+	}
+
+	ip, err := bootstrapLookup(ctx, r.host, r.bootstraps)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConf := &tls.Config{
+		ServerName: r.host,
+		NextProtos: doqALPN,
+	}
+	sess, err := quic.DialAddr(ctx, net.JoinHostPort(ip, r.port), tlsConf, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.session = sess
+	return sess, nil
+}
+
+func (r *DoQResolver) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	sess, err := r.getSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := sess.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(packed)))
+	if _, err := stream.Write(append(length, packed...)); err != nil {
+		return nil, err
+	}
+	// The client signals it has no more data to send by closing its side
+	// of the (bidirectional) stream immediately after the query.
+	if err := stream.Close(); err != nil {
+		return nil, err
+	}
+
+	lenBuf := make([]byte, 2)
+	if _, err := io.ReadFull(stream, lenBuf); err != nil {
+		return nil, err
+	}
+	respLen := binary.BigEndian.Uint16(lenBuf)
+
+	respBuf := make([]byte, respLen)
+	if _, err := io.ReadFull(stream, respBuf); err != nil {
+		return nil, err
+	}
+
+	answer := new(dns.Msg)
+	if err := answer.Unpack(respBuf); err != nil {
+		return nil, err
+	}
+	return answer, nil
+}
+
+// Stop closes the underlying QUIC session, if one is open.
+func (r *DoQResolver) Stop() {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.session != nil {
+		r.session.CloseWithError(0, "")
+		r.session = nil
+	}
+}
+
+// String returns the DoQ server address.
+func (r *DoQResolver) String() string {
+	return "quic://" + net.JoinHostPort(r.host, r.port)
+}
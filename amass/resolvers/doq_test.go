@@ -0,0 +1,50 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolvers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+func TestNewDoQResolverAddressParsing(t *testing.T) {
+	tests := []struct {
+		server   string
+		wantHost string
+		wantPort string
+	}{
+		{"quic://dns.adguard.com", "dns.adguard.com", "853"},
+		{"dns.adguard.com", "dns.adguard.com", "853"},
+		{"quic://dns.adguard.com:8853", "dns.adguard.com", "8853"},
+		{"9.9.9.9:853", "9.9.9.9", "853"},
+	}
+
+	for _, tt := range tests {
+		r, err := NewDoQResolver(tt.server)
+		if err != nil {
+			t.Fatalf("NewDoQResolver(%q) returned error: %v", tt.server, err)
+		}
+		if r.host != tt.wantHost || r.port != tt.wantPort {
+			t.Errorf("NewDoQResolver(%q) = host %q port %q, want host %q port %q",
+				tt.server, r.host, r.port, tt.wantHost, tt.wantPort)
+		}
+	}
+}
+
+func TestIsIdempotentRetry(t *testing.T) {
+	if isIdempotentRetry(&quic.ApplicationError{ErrorCode: 0x5}) != true {
+		t.Error("application error 0x5 should be retryable")
+	}
+	if isIdempotentRetry(&quic.ApplicationError{ErrorCode: 0x1}) != false {
+		t.Error("application error 0x1 should not be retryable")
+	}
+	if isIdempotentRetry(errors.New("use of closed network connection")) != true {
+		t.Error("a \"closed\" error should be retryable")
+	}
+	if isIdempotentRetry(errors.New("timeout")) != false {
+		t.Error("an unrelated error should not be retryable")
+	}
+}
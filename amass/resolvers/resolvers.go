@@ -0,0 +1,185 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package resolvers provides pluggable DNS resolver backends, including
+// encrypted-transport resolvers (DoH, DoQ), that can be mixed into a single
+// round-robin pool used by Amass's passive sources and brute forcing.
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver is satisfied by every resolver backend (plain, DoH, DoQ) so the
+// rest of Amass can treat them interchangeably.
+type Resolver interface {
+	// Resolve performs a DNS lookup of name for the provided qtype
+	// (e.g. dns.TypeA) and returns the resolved IP addresses.
+	Resolve(ctx context.Context, name string, qtype uint16) ([]net.IP, error)
+	// Stop releases any resources (connections, sessions) held by the resolver.
+	Stop()
+	// String returns an identifier for the resolver, typically its address.
+	String() string
+}
+
+// poolUnhealthyThreshold is how many consecutive failed lookups mark a
+// resolver unhealthy, and poolUnhealthyCooldown is how long it stays skipped
+// afterward before the pool gives it another chance.
+const (
+	poolUnhealthyThreshold = 5
+	poolUnhealthyCooldown  = 30 * time.Second
+)
+
+// poolEntry wraps a Resolver with the consecutive-failure bookkeeping Pool
+// uses to decide whether it's currently healthy.
+type poolEntry struct {
+	resolver Resolver
+
+	sync.Mutex
+	consecFails    int
+	unhealthyUntil time.Time
+}
+
+func (e *poolEntry) recordOutcome(err error) {
+	e.Lock()
+	defer e.Unlock()
+
+	if err == nil {
+		e.consecFails = 0
+		e.unhealthyUntil = time.Time{}
+		return
+	}
+	e.consecFails++
+	if e.consecFails >= poolUnhealthyThreshold {
+		e.unhealthyUntil = time.Now().Add(poolUnhealthyCooldown)
+	}
+}
+
+func (e *poolEntry) healthy() bool {
+	e.Lock()
+	defer e.Unlock()
+	return time.Now().After(e.unhealthyUntil)
+}
+
+// Pool distributes lookups across a set of Resolvers in round-robin order,
+// skipping any resolver that is currently marked unhealthy (it has failed
+// poolUnhealthyThreshold lookups in a row) until its cooldown expires.
+type Pool struct {
+	sync.Mutex
+	resolvers []*poolEntry
+	next      int
+}
+
+// NewPool returns a Pool ready to distribute lookups across resolvers.
+func NewPool(resolvers []Resolver) *Pool {
+	p := &Pool{}
+	for _, r := range resolvers {
+		p.resolvers = append(p.resolvers, &poolEntry{resolver: r})
+	}
+	return p
+}
+
+// AddResolver appends a new backend to the pool at runtime.
+func (p *Pool) AddResolver(r Resolver) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.resolvers = append(p.resolvers, &poolEntry{resolver: r})
+}
+
+// Resolve hands the lookup to the next healthy resolver in the rotation,
+// recording the outcome against that resolver's health tracking.
+func (p *Pool) Resolve(ctx context.Context, name string, qtype uint16) ([]net.IP, error) {
+	e := p.next_()
+	if e == nil {
+		return nil, errors.New("resolver pool is empty")
+	}
+
+	ips, err := e.resolver.Resolve(ctx, name, qtype)
+	e.recordOutcome(err)
+	return ips, err
+}
+
+func (p *Pool) next_() *poolEntry {
+	p.Lock()
+	n := len(p.resolvers)
+	if n == 0 {
+		p.Unlock()
+		return nil
+	}
+	start := p.next
+	p.next = (p.next + 1) % n
+	p.Unlock()
+
+	for i := 0; i < n; i++ {
+		e := p.resolvers[(start+i)%n]
+		if e.healthy() {
+			return e
+		}
+	}
+	return nil
+}
+
+// Stop releases every resolver held by the pool.
+func (p *Pool) Stop() {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, e := range p.resolvers {
+		e.resolver.Stop()
+	}
+	p.resolvers = nil
+}
+
+// NewResolver builds the appropriate Resolver backend for a server spec
+// taken straight from the Amass config file, dispatching on URL scheme:
+// "https://" selects DoH, "quic://" selects DoQ, and anything else is left
+// for the plain UDP/TCP resolver pool to handle.
+func NewResolver(spec string, bootstraps ...string) (Resolver, error) {
+	switch {
+	case strings.HasPrefix(spec, "https://"):
+		return NewDoHResolver(spec, bootstraps...)
+	case strings.HasPrefix(spec, "quic://"):
+		return NewDoQResolver(spec, bootstraps...)
+	}
+	return nil, fmt.Errorf("resolvers: unrecognized server spec %s", spec)
+}
+
+// bootstrapLookup resolves host (which may already be an IP address) using
+// the provided bootstrap resolvers, falling back to the system resolver
+// when none are configured. It is used by resolver backends that are given
+// a hostname-based server address (e.g. dns.adguard.com) instead of an IP.
+func bootstrapLookup(ctx context.Context, host string, bootstraps []string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return host, nil
+	}
+
+	if len(bootstraps) == 0 {
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil || len(ips) == 0 {
+			return "", errors.New("bootstrap lookup failed for " + host)
+		}
+		return ips[0].IP.String(), nil
+	}
+
+	boot := bootstraps[rand.Intn(len(bootstraps))]
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 5 * time.Second}
+			return d.DialContext(ctx, network, net.JoinHostPort(boot, "53"))
+		},
+	}
+	ips, err := r.LookupIPAddr(ctx, host)
+	if err != nil || len(ips) == 0 {
+		return "", errors.New("bootstrap lookup failed for " + host)
+	}
+	return ips[0].IP.String(), nil
+}
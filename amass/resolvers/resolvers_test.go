@@ -0,0 +1,92 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+// stubResolver is a minimal Resolver used to exercise Pool's dispatch logic
+// without any real network traffic. When failNext is true, Resolve returns
+// an error instead of a result.
+type stubResolver struct {
+	name     string
+	failNext bool
+}
+
+func (s *stubResolver) Resolve(ctx context.Context, name string, qtype uint16) ([]net.IP, error) {
+	if s.failNext {
+		return nil, errors.New("stub resolver failure")
+	}
+	return nil, nil
+}
+func (s *stubResolver) Stop()          {}
+func (s *stubResolver) String() string { return s.name }
+
+func TestPoolRoundRobin(t *testing.T) {
+	a, b, c := &stubResolver{name: "a"}, &stubResolver{name: "b"}, &stubResolver{name: "c"}
+	p := NewPool([]Resolver{a, b, c})
+
+	var order []string
+	for i := 0; i < 6; i++ {
+		order = append(order, p.next_().resolver.String())
+	}
+
+	want := []string{"a", "b", "c", "a", "b", "c"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("rotation order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestPoolSkipsUnhealthyResolver(t *testing.T) {
+	bad := &stubResolver{name: "bad", failNext: true}
+	p := NewPool([]Resolver{bad})
+
+	// Drive bad past poolUnhealthyThreshold consecutive failures.
+	for i := 0; i < poolUnhealthyThreshold; i++ {
+		if _, err := p.Resolve(context.Background(), "example.com", 1); err == nil {
+			t.Fatal("Resolve against a failing stub resolver should return its error")
+		}
+	}
+
+	good := &stubResolver{name: "good"}
+	p.AddResolver(good)
+
+	for i := 0; i < 4; i++ {
+		e := p.next_()
+		if e.resolver.String() != "good" {
+			t.Fatalf("next_() returned %q, want the healthy resolver once bad is blacklisted", e.resolver.String())
+		}
+	}
+}
+
+func TestPoolEmpty(t *testing.T) {
+	p := NewPool(nil)
+	if _, err := p.Resolve(context.Background(), "example.com", 1); err == nil {
+		t.Fatal("Resolve on an empty pool should return an error")
+	}
+}
+
+func TestNewResolverDispatch(t *testing.T) {
+	if r, err := NewResolver("https://1.1.1.1/dns-query"); err != nil || r == nil {
+		t.Errorf("NewResolver with an https:// spec should select DoH: %v", err)
+	} else if _, ok := r.(*DoHResolver); !ok {
+		t.Errorf("NewResolver with an https:// spec returned %T, want *DoHResolver", r)
+	}
+
+	if r, err := NewResolver("quic://dns.adguard.com"); err != nil || r == nil {
+		t.Errorf("NewResolver with a quic:// spec should select DoQ: %v", err)
+	} else if _, ok := r.(*DoQResolver); !ok {
+		t.Errorf("NewResolver with a quic:// spec returned %T, want *DoQResolver", r)
+	}
+
+	if _, err := NewResolver("8.8.8.8:53"); err == nil {
+		t.Error("NewResolver with a plain server spec should return an error (handled by the UDP/TCP pool instead)")
+	}
+}
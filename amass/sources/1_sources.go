@@ -5,18 +5,13 @@ package sources
 
 import (
 	"fmt"
-	"net"
-	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/PuerkitoBio/fetchbot"
-	"github.com/PuerkitoBio/goquery"
 	"github.com/lanzay/amass/amass/core"
-	"github.com/lanzay/amass/amass/utils"
+	crawlpkg "github.com/lanzay/amass/amass/crawl"
 )
 
 var (
@@ -42,6 +37,7 @@ func GetAllSources(config *core.Config, bus *core.EventBus) []core.Service {
 		NewCIRCL(config, bus),
 		NewCommonCrawl(config, bus),
 		NewCrtsh(config, bus),
+		NewCTLog(config, bus),
 		NewDNSDB(config, bus),
 		NewDNSDumpster(config, bus),
 		NewDNSTable(config, bus),
@@ -105,111 +101,21 @@ func cleanName(name string) string {
 // Web archive crawler implementation
 //-------------------------------------------------------------------------------------------------
 
+// crawl seeds the polite archive crawler at base/year/sub and returns every
+// subdomain of domain it discovers, honoring the target archive's
+// robots.txt and sitemap.xml along the way. See package amass/crawl for the
+// crawler implementation shared across the archive sources.
 func crawl(service core.Service, base, domain, sub string) ([]string, error) {
-	var results []string
-	var filterMutex sync.Mutex
-	filter := make(map[string]struct{})
+	c := crawlpkg.New(crawlpkg.DefaultConfig(), domain, service.Quit())
 
-	year := strconv.Itoa(time.Now().Year())
-	mux := fetchbot.NewMux()
-	links := make(chan string, 50)
-	names := make(chan string, 50)
-	linksFilter := make(map[string]struct{})
-
-	mux.HandleErrors(fetchbot.HandlerFunc(func(ctx *fetchbot.Context, res *http.Response, err error) {
-		//service.Config.Log.Printf("Crawler error: %s %s - %v", ctx.Cmd.Method(), ctx.Cmd.URL(), err)
-	}))
-
-	mux.Response().Method("GET").ContentType("text/html").Handler(fetchbot.HandlerFunc(
-		func(ctx *fetchbot.Context, res *http.Response, err error) {
-			filterMutex.Lock()
-			defer filterMutex.Unlock()
-
-			u := res.Request.URL.String()
-			if _, found := filter[u]; found {
-				return
-			}
-			filter[u] = struct{}{}
-
-			linksAndNames(domain, ctx, res, links, names)
-		}))
-
-	f := fetchbot.New(fetchbot.HandlerFunc(func(ctx *fetchbot.Context, res *http.Response, err error) {
-		mux.Handle(ctx, res, err)
-	}))
-	setFetcherConfig(f)
-
-	q := f.Start()
-	u := fmt.Sprintf("%s/%s/%s", base, year, sub)
-	if _, err := q.SendStringGet(u); err != nil {
+	u := fmt.Sprintf("%s/%s/%s", base, currentYear(), sub)
+	results, err := c.Crawl(u)
+	if err != nil {
 		return results, fmt.Errorf("Crawler error: GET %s - %v", u, err)
 	}
-
-	t := time.NewTimer(10 * time.Second)
-loop:
-	for {
-		select {
-		case l := <-links:
-			if _, ok := linksFilter[l]; ok {
-				continue
-			}
-			linksFilter[l] = struct{}{}
-			q.SendStringGet(l)
-		case n := <-names:
-			results = utils.UniqueAppend(results, n)
-		case <-t.C:
-			go func() {
-				q.Cancel()
-			}()
-		case <-q.Done():
-			break loop
-		case <-service.Quit():
-			break loop
-		}
-	}
 	return results, nil
 }
 
-func linksAndNames(domain string, ctx *fetchbot.Context, res *http.Response, links, names chan string) error {
-	// Process the body to find the links
-	doc, err := goquery.NewDocumentFromResponse(res)
-	if err != nil {
-		return fmt.Errorf("crawler error: %s %s - %s", ctx.Cmd.Method(), ctx.Cmd.URL(), err)
-	}
-
-	re := utils.SubdomainRegex(domain)
-	if re == nil {
-		return fmt.Errorf("crawler error: Failed to obtain regex object for: %s", domain)
-	}
-	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
-		val, _ := s.Attr("href")
-		// Resolve address
-		u, err := ctx.Cmd.URL().Parse(val)
-		if err != nil {
-			return
-		}
-
-		if sub := re.FindString(u.String()); sub != "" {
-			names <- sub
-			links <- u.String()
-		}
-	})
-	return nil
-}
-
-func setFetcherConfig(f *fetchbot.Fetcher) {
-	d := net.Dialer{}
-	f.HttpClient = &http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			DialContext:           d.DialContext,
-			MaxIdleConns:          200,
-			IdleConnTimeout:       5 * time.Second,
-			TLSHandshakeTimeout:   5 * time.Second,
-			ExpectContinueTimeout: 5 * time.Second,
-		},
-	}
-	f.CrawlDelay = 1 * time.Second
-	f.DisablePoliteness = true
-	f.UserAgent = utils.UserAgent
+func currentYear() string {
+	return strconv.Itoa(time.Now().Year())
 }
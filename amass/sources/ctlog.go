@@ -0,0 +1,494 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/lanzay/amass/amass/core"
+	"github.com/lanzay/amass/amass/utils"
+)
+
+// ctLogListURL is Google's published list of CT logs, which also covers the
+// logs Apple requires for its own log policy.
+const ctLogListURL = "https://www.gstatic.com/ct/log_list/v3/log_list.json"
+
+// entriesPerPage is the batch size used when paging through get-entries.
+const entriesPerPage = 256
+
+// entriesPageDelay paces consecutive get-entries calls against a single
+// log so a large backlog (e.g. the first run against a big log, where
+// checkpoint starts at zero) doesn't hammer the log's API.
+const entriesPageDelay = 250 * time.Millisecond
+
+// CTLog is a core.Service that tails Certificate Transparency logs directly
+// via the logs' ct/v1 HTTP API (RFC 6962), rather than depending on a
+// third-party aggregator such as crt.sh or CertSpotter. The RFC 9162 (CT v2)
+// endpoints and structures are not used.
+type CTLog struct {
+	core.BaseService
+
+	Config *core.Config
+	Bus    *core.EventBus
+
+	domainRE []*regexp.Regexp
+
+	filterLock sync.Mutex
+	filter     map[string]struct{}
+}
+
+// ctLogListEntry is the subset of fields amass needs from log_list.json.
+type ctLogListEntry struct {
+	URL string `json:"url"`
+	Key string `json:"key"` // base64-encoded DER SubjectPublicKeyInfo
+}
+
+type ctLogList struct {
+	Operators []struct {
+		Logs []ctLogListEntry `json:"logs"`
+	} `json:"operators"`
+}
+
+// sth mirrors the ct/v1 get-sth JSON response (RFC 6962).
+type sth struct {
+	TreeSize          int64  `json:"tree_size"`
+	Timestamp         int64  `json:"timestamp"`
+	RootHash          string `json:"sha256_root_hash"`
+	TreeHeadSignature string `json:"tree_head_signature"`
+}
+
+// getEntriesResp mirrors the get-entries JSON response.
+type getEntriesResp struct {
+	Entries []struct {
+		LeafInput string `json:"leaf_input"`
+		ExtraData string `json:"extra_data"`
+	} `json:"entries"`
+}
+
+// NewCTLog returns a CTLog service ready to be started against every log
+// discovered from the Google/Apple log lists.
+func NewCTLog(config *core.Config, bus *core.EventBus) *CTLog {
+	c := &CTLog{
+		Config: config,
+		Bus:    bus,
+		filter: make(map[string]struct{}),
+	}
+	c.BaseService = *core.NewBaseService(c, "CT Log Tailing")
+	return c
+}
+
+// OnStart discovers the current CT log list and launches one tailing
+// goroutine per log.
+func (c *CTLog) OnStart() error {
+	for _, domain := range c.Config.Domains() {
+		if re := utils.SubdomainRegex(domain); re != nil {
+			c.domainRE = append(c.domainRE, re)
+		}
+	}
+
+	logs, err := fetchLogList()
+	if err != nil {
+		return fmt.Errorf("CT Log Tailing: failed to fetch log list: %v", err)
+	}
+
+	for _, l := range logs {
+		go c.tailLog(l)
+	}
+	return nil
+}
+
+// inScope reports whether name matches one of the target apex domains this
+// service was configured with.
+func (c *CTLog) inScope(name string) bool {
+	for _, re := range c.domainRE {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func fetchLogList() ([]ctLogListEntry, error) {
+	page, err := utils.RequestWebPage(ctLogListURL, nil, nil, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	var list ctLogList
+	if err := json.Unmarshal([]byte(page), &list); err != nil {
+		return nil, err
+	}
+
+	var logs []ctLogListEntry
+	for _, op := range list.Operators {
+		logs = append(logs, op.Logs...)
+	}
+	return logs, nil
+}
+
+// tailLog polls one log's get-sth endpoint, and whenever the tree has grown,
+// pages through the new entries and feeds any names found to the event bus.
+func (c *CTLog) tailLog(l ctLogListEntry) {
+	pubKey, err := parseLogPublicKey(l.Key)
+	if err != nil {
+		return
+	}
+
+	checkpoint := loadCheckpoint(c.Config.Dir, l.URL)
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Quit():
+			return
+		case <-ticker.C:
+		}
+
+		head, err := getSTH(l.URL)
+		if err != nil || head == nil {
+			continue
+		}
+
+		if err := verifySTH(pubKey, l.URL, head); err != nil {
+			continue
+		}
+
+		if head.TreeSize <= checkpoint {
+			continue
+		}
+
+		// Bound how far a single tick advances so that a large backlog
+		// (e.g. the first run against a big log, where checkpoint starts
+		// at zero) is drained incrementally across many ticks instead of
+		// one call paging through the log's entire history.
+		end := head.TreeSize
+		if end-checkpoint > maxEntriesPerTick {
+			end = checkpoint + maxEntriesPerTick
+		}
+
+		checkpoint = c.drainEntries(l.URL, checkpoint, end)
+		storeCheckpoint(c.Config.Dir, l.URL, checkpoint)
+	}
+}
+
+// maxEntriesPerTick bounds how many new entries a single tailLog tick will
+// drain, so a large backlog is worked off incrementally across many ticks
+// rather than one call paging through a log's entire history.
+const maxEntriesPerTick = 100000
+
+// drainEntries pages through get-entries in entriesPerPage batches from
+// start (inclusive) to end (exclusive), extracting in-scope domain names as
+// it goes. Paging is paced by entriesPageDelay and stops early if the
+// service is shut down or a page fails to fetch/parse, so a large backlog
+// cannot flood the log's API or block Stop() from returning. It returns the
+// position (exclusive) through which entries were fully processed, which
+// may be less than end if the drain was cut short.
+func (c *CTLog) drainEntries(logURL string, start, end int64) int64 {
+	ticker := time.NewTicker(entriesPageDelay)
+	defer ticker.Stop()
+
+	done := start
+	for s := start; s < end; s += entriesPerPage {
+		select {
+		case <-c.Quit():
+			return done
+		case <-ticker.C:
+		}
+
+		e := s + entriesPerPage - 1
+		if e >= end {
+			e = end - 1
+		}
+
+		url := fmt.Sprintf("%sct/v1/get-entries?start=%d&end=%d", logURL, s, e)
+		page, err := utils.RequestWebPage(url, nil, nil, "", "")
+		if err != nil {
+			return done
+		}
+
+		var resp getEntriesResp
+		if err := json.Unmarshal([]byte(page), &resp); err != nil {
+			return done
+		}
+
+		for _, entry := range resp.Entries {
+			leaf, err := base64.StdEncoding.DecodeString(entry.LeafInput)
+			if err != nil {
+				continue
+			}
+			for _, name := range namesFromMerkleLeaf(leaf) {
+				c.emit(name)
+			}
+		}
+		done = e + 1
+	}
+	return done
+}
+
+// emit publishes name to the event bus, provided it matches one of the
+// service's target apex domains and hasn't already been reported.
+func (c *CTLog) emit(name string) {
+	name = cleanName(name)
+	if name == "" || !c.inScope(name) {
+		return
+	}
+
+	c.filterLock.Lock()
+	_, seen := c.filter[name]
+	c.filter[name] = struct{}{}
+	c.filterLock.Unlock()
+	if seen {
+		return
+	}
+
+	c.Bus.Publish(core.NewNameTopic, name)
+}
+
+// namesFromMerkleLeaf unpacks a MerkleTreeLeaf -> TimestampedEntry and
+// pulls the CommonName/SubjectAltName DNS entries out of the embedded
+// precert or x509 certificate.
+func namesFromMerkleLeaf(leaf []byte) []string {
+	// MerkleTreeLeaf: version(1) + leaf_type(1) + TimestampedEntry
+	if len(leaf) < 12 {
+		return nil
+	}
+	entryType := binary.BigEndian.Uint16(leaf[10:12])
+	signedEntry := leaf[12:]
+
+	switch entryType {
+	case 0: // x509_entry: ASN1Cert, a full DER certificate as opaque<1..2^24-1>
+		der, ok := readUint24Opaque(signedEntry)
+		if !ok {
+			return nil
+		}
+		return namesFromDER(der)
+	case 1: // precert_entry: issuer_key_hash[32] then opaque TBSCertificate
+		if len(signedEntry) <= 32 {
+			return nil
+		}
+		der, ok := readUint24Opaque(signedEntry[32:])
+		if !ok {
+			return nil
+		}
+		return namesFromTBS(der)
+	}
+	return nil
+}
+
+// readUint24Opaque reads a TLS-style <1..2^24-1> opaque: a 3-byte
+// big-endian length prefix followed by that many bytes.
+func readUint24Opaque(b []byte) ([]byte, bool) {
+	if len(b) < 3 {
+		return nil, false
+	}
+	length := int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	if len(b) < 3+length {
+		return nil, false
+	}
+	return b[3 : 3+length], true
+}
+
+func namesFromDER(der []byte) []string {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil
+	}
+	return namesFromParsedCert(cert.Subject.CommonName, cert.DNSNames)
+}
+
+// tbsCertificate mirrors enough of RFC 5280's TBSCertificate for name
+// extraction: the subject's distinguished name and its extensions.
+type tbsCertificate struct {
+	Raw                asn1.RawValue
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       asn1.RawValue
+	SignatureAlgorithm asn1.RawValue
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	IssuerUniqueID     asn1.BitString `asn1:"optional,tag:1"`
+	SubjectUniqueID    asn1.BitString `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// namesFromTBS parses a bare TBSCertificate (as embedded in a precert log
+// entry) well enough to pull CommonName and SubjectAltName DNS entries,
+// without requiring the issuer's full certificate to validate signatures
+// (precert TBSCertificates are never validly signed on their own).
+func namesFromTBS(der []byte) []string {
+	var tbs tbsCertificate
+	if _, err := asn1.Unmarshal(der, &tbs); err != nil {
+		return nil
+	}
+
+	var rdn pkix.RDNSequence
+	if _, err := asn1.Unmarshal(tbs.Subject.FullBytes, &rdn); err != nil {
+		return nil
+	}
+	var subject pkix.Name
+	subject.FillFromRDNSequence(&rdn)
+
+	var dnsNames []string
+	for _, ext := range tbs.Extensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			dnsNames = append(dnsNames, parseSANDNSNames(ext.Value)...)
+		}
+	}
+	return namesFromParsedCert(subject.CommonName, dnsNames)
+}
+
+// parseSANDNSNames extracts dNSName [2] GeneralName entries from the DER
+// body of a subjectAltName extension (RFC 5280 section 4.2.1.6).
+func parseSANDNSNames(value []byte) []string {
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(value, &seq); err != nil {
+		return nil
+	}
+
+	var names []string
+	rest := seq.Bytes
+	for len(rest) > 0 {
+		var v asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &v)
+		if err != nil {
+			break
+		}
+		// dNSName is context-specific, primitive, tag 2.
+		if v.Class == asn1.ClassContextSpecific && v.Tag == 2 {
+			names = append(names, string(v.Bytes))
+		}
+	}
+	return names
+}
+
+func namesFromParsedCert(commonName string, dnsNames []string) []string {
+	var names []string
+	if commonName != "" {
+		names = append(names, commonName)
+	}
+	names = append(names, dnsNames...)
+	return names
+}
+
+// getSTH fetches and decodes a log's current signed tree head. Logs return a
+// fresh tree_size/timestamp on every call, so there is nothing worth
+// conditionally re-fetching here the way archive crawl pages are.
+func getSTH(logURL string) (*sth, error) {
+	page, err := utils.RequestWebPage(logURL+"ct/v1/get-sth", nil, nil, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	var head sth
+	if err := json.Unmarshal([]byte(page), &head); err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+// verifySTH checks the STH's tree_head_signature against the log's pinned
+// public key, over the v1 tree head signed structure defined in RFC 6962.
+func verifySTH(pub *ecdsa.PublicKey, logURL string, head *sth) error {
+	sig, err := base64.StdEncoding.DecodeString(head.TreeHeadSignature)
+	if err != nil {
+		return err
+	}
+	root, err := base64.StdEncoding.DecodeString(head.RootHash)
+	if err != nil {
+		return err
+	}
+
+	signed := make([]byte, 0, 2+8+8+32)
+	signed = append(signed, 0, 1) // version=0 (v1), signature_type=1 (tree_hash)
+	var ts, size [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(head.Timestamp))
+	binary.BigEndian.PutUint64(size[:], uint64(head.TreeSize))
+	signed = append(signed, ts[:]...)
+	signed = append(signed, size[:]...)
+	signed = append(signed, root...)
+
+	digest := sha256.Sum256(signed)
+
+	// The wire signature is a DigitallySigned struct (RFC 5246 section
+	// 4.7): hash_algorithm(1) + signature_algorithm(1) + a 2-byte
+	// big-endian length, followed by the DER-encoded ECDSA-Sig-Value.
+	if len(sig) < 4 {
+		return fmt.Errorf("CT Log Tailing: malformed STH signature for %s", logURL)
+	}
+	sigLen := int(sig[2])<<8 | int(sig[3])
+	if len(sig) < 4+sigLen {
+		return fmt.Errorf("CT Log Tailing: truncated STH signature for %s", logURL)
+	}
+
+	var ecdsaSig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(sig[4:4+sigLen], &ecdsaSig); err != nil {
+		return err
+	}
+	if !ecdsa.Verify(pub, digest[:], ecdsaSig.R, ecdsaSig.S) {
+		return fmt.Errorf("CT Log Tailing: STH signature verification failed for %s", logURL)
+	}
+	return nil
+}
+
+func parseLogPublicKey(b64Key string) (*ecdsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(b64Key)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	ecPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("CT Log Tailing: unsupported log public key type")
+	}
+	return ecPub, nil
+}
+
+func checkpointPath(outputDir, logURL string) string {
+	sum := sha256.Sum256([]byte(logURL))
+	return filepath.Join(outputDir, "ctlog", fmt.Sprintf("%x.checkpoint", sum[:8]))
+}
+
+func loadCheckpoint(outputDir, logURL string) int64 {
+	raw, err := ioutil.ReadFile(checkpointPath(outputDir, logURL))
+	if err != nil {
+		return 0
+	}
+	var size int64
+	fmt.Sscanf(string(raw), "%d", &size)
+	return size
+}
+
+func storeCheckpoint(outputDir, logURL string, size int64) {
+	path := checkpointPath(outputDir, logURL)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(path, []byte(fmt.Sprintf("%d", size)), 0644)
+}
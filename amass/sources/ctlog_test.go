@@ -0,0 +1,223 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestReadUint24Opaque(t *testing.T) {
+	payload := []byte{0xAA, 0xBB, 0xCC, 0xDD}
+	b := append([]byte{0x00, 0x00, byte(len(payload))}, payload...)
+	b = append(b, 0xEE) // trailing bytes the reader should ignore
+
+	got, ok := readUint24Opaque(b)
+	if !ok {
+		t.Fatal("readUint24Opaque failed on well-formed input")
+	}
+	if string(got) != string(payload) {
+		t.Fatalf("readUint24Opaque = %x, want %x", got, payload)
+	}
+
+	if _, ok := readUint24Opaque([]byte{0x00, 0x00, 0x05, 0x01}); ok {
+		t.Fatal("readUint24Opaque should fail when the declared length exceeds the available bytes")
+	}
+	if _, ok := readUint24Opaque([]byte{0x00, 0x01}); ok {
+		t.Fatal("readUint24Opaque should fail on a truncated length prefix")
+	}
+}
+
+// selfSignedCert builds a minimal self-signed certificate with the given
+// CommonName and SAN DNS names, returning both the parsed certificate and
+// its raw DER, so callers can test both the x509_entry and precert_entry
+// MerkleTreeLeaf code paths.
+func selfSignedCert(t *testing.T, cn string, sans []string) (*x509.Certificate, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     sans,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse generated certificate: %v", err)
+	}
+	return cert, der
+}
+
+func merkleLeaf(entryType uint16, signedEntry []byte) []byte {
+	leaf := make([]byte, 12)
+	leaf[0] = 0 // version
+	leaf[1] = 0 // leaf_type = timestamped_entry
+	binary.BigEndian.PutUint16(leaf[10:12], entryType)
+	return append(leaf, signedEntry...)
+}
+
+func uint24Opaque(der []byte) []byte {
+	length := len(der)
+	return append([]byte{byte(length >> 16), byte(length >> 8), byte(length)}, der...)
+}
+
+func TestNamesFromMerkleLeaf_X509Entry(t *testing.T) {
+	_, der := selfSignedCert(t, "cn.example.com", []string{"www.example.com", "api.example.com"})
+
+	leaf := merkleLeaf(0, uint24Opaque(der))
+	names := namesFromMerkleLeaf(leaf)
+
+	want := map[string]bool{"cn.example.com": true, "www.example.com": true, "api.example.com": true}
+	if len(names) != len(want) {
+		t.Fatalf("namesFromMerkleLeaf = %v, want %v", names, want)
+	}
+	for _, n := range names {
+		if !want[n] {
+			t.Errorf("unexpected name %q", n)
+		}
+	}
+}
+
+func TestNamesFromMerkleLeaf_PrecertEntry(t *testing.T) {
+	cert, _ := selfSignedCert(t, "precert.example.com", []string{"alt.example.com"})
+
+	// A real precert log entry embeds a bare TBSCertificate DER; the
+	// certificate's own RawTBSCertificate is exactly that encoding.
+	tbsDER := cert.RawTBSCertificate
+
+	issuerKeyHash := make([]byte, 32) // precert_entry carries this before the opaque TBS
+	signedEntry := append(issuerKeyHash, uint24Opaque(tbsDER)...)
+
+	leaf := merkleLeaf(1, signedEntry)
+	names := namesFromMerkleLeaf(leaf)
+
+	want := map[string]bool{"precert.example.com": true, "alt.example.com": true}
+	if len(names) != len(want) {
+		t.Fatalf("namesFromMerkleLeaf (precert) = %v, want %v", names, want)
+	}
+	for _, n := range names {
+		if !want[n] {
+			t.Errorf("unexpected name %q", n)
+		}
+	}
+}
+
+func TestParseSANDNSNames(t *testing.T) {
+	_, der := selfSignedCert(t, "", []string{"one.example.com", "two.example.com"})
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	var ext []byte
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(oidExtensionSubjectAltName) {
+			ext = e.Value
+		}
+	}
+	if ext == nil {
+		t.Fatal("generated certificate is missing its subjectAltName extension")
+	}
+
+	names := parseSANDNSNames(ext)
+	if len(names) != 2 || names[0] != "one.example.com" || names[1] != "two.example.com" {
+		t.Fatalf("parseSANDNSNames = %v, want [one.example.com two.example.com]", names)
+	}
+}
+
+// signSTH builds the DigitallySigned-wrapped ECDSA signature over an STH the
+// same way a real CT log would, so verifySTH can be exercised end to end
+// against a key pair generated for the test.
+func signSTH(t *testing.T, priv *ecdsa.PrivateKey, head *sth) {
+	t.Helper()
+
+	root, err := base64.StdEncoding.DecodeString(head.RootHash)
+	if err != nil {
+		t.Fatalf("invalid root hash fixture: %v", err)
+	}
+
+	signed := make([]byte, 0, 2+8+8+len(root))
+	signed = append(signed, 0, 1)
+	var ts, size [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(head.Timestamp))
+	binary.BigEndian.PutUint64(size[:], uint64(head.TreeSize))
+	signed = append(signed, ts[:]...)
+	signed = append(signed, size[:]...)
+	signed = append(signed, root...)
+
+	digest := sha256.Sum256(signed)
+	r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign STH fixture: %v", err)
+	}
+
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatalf("failed to DER-encode signature: %v", err)
+	}
+
+	wire := []byte{4, 3, byte(len(der) >> 8), byte(len(der))} // hash_alg=sha256(4), sig_alg=ecdsa(3)
+	wire = append(wire, der...)
+	head.TreeHeadSignature = base64.StdEncoding.EncodeToString(wire)
+}
+
+func TestVerifySTH(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	root := sha256.Sum256([]byte("fixture root"))
+	head := &sth{
+		TreeSize:  42,
+		Timestamp: 1700000000000,
+		RootHash:  base64.StdEncoding.EncodeToString(root[:]),
+	}
+	signSTH(t, priv, head)
+
+	if err := verifySTH(&priv.PublicKey, "https://ct.example.com/", head); err != nil {
+		t.Fatalf("verifySTH rejected a validly signed STH: %v", err)
+	}
+
+	tampered := *head
+	tampered.TreeSize = 43
+	if err := verifySTH(&priv.PublicKey, "https://ct.example.com/", &tampered); err == nil {
+		t.Fatal("verifySTH accepted an STH whose tree_size was tampered with after signing")
+	}
+}
+
+func TestCTLogInScope(t *testing.T) {
+	c := &CTLog{domainRE: []*regexp.Regexp{
+		regexp.MustCompile(`(?i)[a-zA-Z0-9\-]+\.example\.com$`),
+	}}
+
+	if !c.inScope("www.example.com") {
+		t.Error("www.example.com should be in scope")
+	}
+	if c.inScope("www.other.com") {
+		t.Error("www.other.com should not be in scope")
+	}
+}
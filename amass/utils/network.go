@@ -4,6 +4,10 @@
 package utils
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"errors"
 	"io"
@@ -15,8 +19,8 @@ import (
 	"net/url"
 	"strings"
 	"time"
-	"bytes"
 
+	"github.com/andybalholm/brotli"
 	"github.com/caffix/cloudflare-roundtripper/cfrt"
 )
 
@@ -79,8 +83,24 @@ func CheckCookie(urlString string, cookieName string) bool {
 }
 
 // RequestWebPage returns a string containing the entire response for
-// the urlstring parameter when successful.
-func RequestWebPage(urlstring string, body io.Reader, hvals map[string]string, uid, secret string) (string, error) {
+// the urlstring parameter when successful. An optional client may be
+// passed (e.g. one returned by NewProxiedClient) so callers can route the
+// request through a specific proxy pool; when omitted, the package's
+// defaultClient is used.
+func RequestWebPage(urlstring string, body io.Reader, hvals map[string]string, uid, secret string, client ...*http.Client) (string, error) {
+	return RequestWebPageWithContext(context.Background(), urlstring, body, hvals, uid, secret, client...)
+}
+
+// RequestWebPageWithContext behaves like RequestWebPage, but binds the
+// request to ctx so callers (e.g. a conditional-request cache wrapping the
+// client's Transport) can cancel it or tell it apart from an unrelated
+// in-flight request.
+func RequestWebPageWithContext(ctx context.Context, urlstring string, body io.Reader, hvals map[string]string, uid, secret string, client ...*http.Client) (string, error) {
+	c := defaultClient
+	if len(client) > 0 && client[0] != nil {
+		c = client[0]
+	}
+
 	method := "GET"
 	if body != nil {
 		method = "POST"
@@ -89,27 +109,55 @@ func RequestWebPage(urlstring string, body io.Reader, hvals map[string]string, u
 	if err != nil {
 		return "", err
 	}
+	req = req.WithContext(ctx)
 	if uid != "" && secret != "" {
 		req.SetBasicAuth(uid, secret)
 	}
 	req.Header.Set("User-Agent", UserAgent)
 	req.Header.Set("Accept", Accept)
 	req.Header.Set("Accept-Language", AcceptLang)
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
 	if hvals != nil {
 		for k, v := range hvals {
 			req.Header.Set(k, v)
 		}
 	}
 
-	resp, err := defaultClient.Do(req)
+	resp, err := c.Do(req)
 	if err != nil {
 		return "", err
 	} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return "", errors.New(resp.Status)
 	}
+	defer resp.Body.Close()
+
+	return decodeBody(resp)
+}
+
+// decodeBody reads resp.Body, transparently unwrapping gzip, deflate, or
+// brotli Content-Encoding. Responses with no Content-Encoding (or "identity")
+// are returned unchanged.
+func decodeBody(resp *http.Response) (string, error) {
+	var reader io.Reader = resp.Body
+
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		reader = flate.NewReader(resp.Body)
+	case "br":
+		reader = brotli.NewReader(resp.Body)
+	}
 
-	in, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
+	in, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
 	return string(in), nil
 }
 
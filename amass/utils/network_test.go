@@ -0,0 +1,105 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatalf("failed to gzip fixture: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func deflateBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		t.Fatalf("failed to create flate writer: %v", err)
+	}
+	if _, err := fw.Write([]byte(s)); err != nil {
+		t.Fatalf("failed to deflate fixture: %v", err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("failed to close flate writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func brotliBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	bw := brotli.NewWriter(&buf)
+	if _, err := bw.Write([]byte(s)); err != nil {
+		t.Fatalf("failed to brotli-compress fixture: %v", err)
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatalf("failed to close brotli writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	const want = "hello, amass"
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"identity", "", []byte(want)},
+		{"unrecognized encoding passed through", "unknown", []byte(want)},
+		{"gzip", "gzip", gzipBytes(t, want)},
+		{"deflate", "deflate", deflateBytes(t, want)},
+		{"brotli", "br", brotliBytes(t, want)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				Header: make(http.Header),
+				Body:   ioutil.NopCloser(bytes.NewReader(tt.body)),
+			}
+			if tt.encoding != "" {
+				resp.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			got, err := decodeBody(resp)
+			if err != nil {
+				t.Fatalf("decodeBody() returned error: %v", err)
+			}
+			if got != want {
+				t.Fatalf("decodeBody() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeBodyInvalidGzip(t *testing.T) {
+	resp := &http.Response{
+		Header: make(http.Header),
+		Body:   ioutil.NopCloser(bytes.NewReader([]byte("not gzip data"))),
+	}
+	resp.Header.Set("Content-Encoding", "gzip")
+
+	if _, err := decodeBody(resp); err == nil {
+		t.Fatal("decodeBody should return an error for malformed gzip data")
+	}
+}
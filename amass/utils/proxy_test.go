@@ -0,0 +1,99 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+)
+
+func TestProxyRouteMatches(t *testing.T) {
+	route := &proxyRoute{conf: &ProxyConfig{
+		Sources:     []string{"Shodan"},
+		DomainGlobs: []string{"*.example.com"},
+	}}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.shodan.io/search", nil)
+	if !route.matches("shodan", req) {
+		t.Error("matches should be case-insensitive on source name")
+	}
+	if route.matches("other-source", req) {
+		t.Error("an unrelated source name over an unrelated host should not match")
+	}
+
+	globReq, _ := http.NewRequest(http.MethodGet, "https://sub.example.com/path", nil)
+	if !route.matches("unrelated", globReq) {
+		t.Error("a request whose host matches a configured domain glob should match")
+	}
+}
+
+// recordingTransport is a minimal http.RoundTripper stub that returns a
+// canned response carrying the given Set-Cookie headers.
+type recordingTransport struct {
+	setCookie []string
+	requests  []*http.Request
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.requests = append(r.requests, req)
+
+	header := make(http.Header)
+	for _, c := range r.setCookie {
+		header.Add("Set-Cookie", c)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: http.NoBody, Request: req}, nil
+}
+
+func TestProxyRoundTripperCapturesAndReplaysCookies(t *testing.T) {
+	jar, _ := cookiejar.New(nil)
+	transport := &recordingTransport{setCookie: []string{"session=abc123; Path=/"}}
+	route := &proxyRoute{
+		conf:      &ProxyConfig{Sources: []string{"testsource"}},
+		transport: transport,
+		jar:       jar,
+		healthy:   true,
+	}
+
+	rt := &proxyRoundTripper{client: &ProxiedClient{routes: []*proxyRoute{route}, direct: http.DefaultTransport}}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://target.example.com/a", nil)
+	req.Header.Set(sourceNameHeader, "testsource")
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip returned error: %v", err)
+	}
+
+	u, _ := url.Parse("https://target.example.com/a")
+	cookies := jar.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Name != "session" || cookies[0].Value != "abc123" {
+		t.Fatalf("jar.Cookies() = %v, want the session cookie captured from the response", cookies)
+	}
+
+	// A second request through the same route should now present the
+	// cookie the first response set, isolated to this proxy's own jar.
+	req2, _ := http.NewRequest(http.MethodGet, "https://target.example.com/b", nil)
+	req2.Header.Set(sourceNameHeader, "testsource")
+	if _, err := rt.RoundTrip(req2); err != nil {
+		t.Fatalf("second RoundTrip returned error: %v", err)
+	}
+
+	outgoing := transport.requests[1]
+	if c, err := outgoing.Cookie("session"); err != nil || c.Value != "abc123" {
+		t.Fatalf("second outgoing request did not carry the cookie captured from the first response: %v", err)
+	}
+}
+
+func TestProxyRoundTripperFallsBackToDirect(t *testing.T) {
+	direct := &recordingTransport{}
+	rt := &proxyRoundTripper{client: &ProxiedClient{direct: direct}}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://unmatched.example.com/", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip returned error: %v", err)
+	}
+	if len(direct.requests) != 1 {
+		t.Fatal("a request matching no proxy route should fall back to the direct transport")
+	}
+}
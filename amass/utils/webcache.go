@@ -0,0 +1,169 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// WebCache stores ETag/Last-Modified metadata and raw response bodies for
+// URLs on disk, allowing repeat scans against archive sources (Wayback,
+// CommonCrawl, ArchiveIt) to skip re-downloading unchanged pages. It is
+// used by wrapping an *http.Client's Transport with Transport, so it works
+// transparently with RequestWebPage and anything else built on that
+// client, instead of duplicating request-building logic of its own.
+type WebCache struct {
+	dir string
+}
+
+// cacheEntry is the on-disk representation of one cached response. Body is
+// the raw (still possibly gzip/br/deflate encoded) response body, so a
+// cache hit can be replayed through the normal Content-Encoding handling
+// in decodeBody exactly as a live response would be.
+type cacheEntry struct {
+	ETag            string `json:"etag,omitempty"`
+	LastModified    string `json:"last_modified,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	ContentType     string `json:"content_type,omitempty"`
+	Body            string `json:"body"` // base64-encoded
+}
+
+// NewWebCache returns a WebCache that persists entries under dir. The
+// directory is created if it does not already exist. The crawl package's
+// DefaultConfig places it under the user's cache directory, not under the
+// Amass output directory.
+func NewWebCache(dir string) (*WebCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &WebCache{dir: dir}, nil
+}
+
+func (c *WebCache) path(urlstring string) string {
+	sum := sha1.Sum([]byte(urlstring))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *WebCache) load(urlstring string) *cacheEntry {
+	raw, err := ioutil.ReadFile(c.path(urlstring))
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+func (c *WebCache) store(urlstring string, entry *cacheEntry) {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(c.path(urlstring), raw, 0644)
+}
+
+// Transport wraps next with conditional-request caching: GET requests are
+// conditioned on any cached ETag/Last-Modified for their URL, and a 304
+// response is replayed from the cached body instead of being handed to the
+// caller as an empty response.
+func (c *WebCache) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &cachingTransport{cache: c, next: next}
+}
+
+type cachingTransport struct {
+	cache *WebCache
+	next  http.RoundTripper
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	cached := t.cache.load(key)
+
+	outgoing := req
+	if cached != nil {
+		outgoing = req.Clone(req.Context())
+		if cached.ETag != "" {
+			outgoing.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			outgoing.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		return cached.toResponse(req), nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, nil
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(raw))
+
+	if etag, lastMod := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"); etag != "" || lastMod != "" {
+		t.cache.store(key, &cacheEntry{
+			ETag:            etag,
+			LastModified:    lastMod,
+			ContentEncoding: resp.Header.Get("Content-Encoding"),
+			ContentType:     resp.Header.Get("Content-Type"),
+			Body:            base64.StdEncoding.EncodeToString(raw),
+		})
+	}
+	return resp, nil
+}
+
+// toResponse replays a cached entry as the body of a synthetic 200 response,
+// preserving the original Content-Encoding/Content-Type so decodeBody
+// handles it exactly as it would a live, uncached response.
+func (e *cacheEntry) toResponse(req *http.Request) *http.Response {
+	raw, _ := base64.StdEncoding.DecodeString(e.Body)
+
+	header := make(http.Header)
+	if e.ContentEncoding != "" {
+		header.Set("Content-Encoding", e.ContentEncoding)
+	}
+	if e.ContentType != "" {
+		header.Set("Content-Type", e.ContentType)
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(raw)),
+		ContentLength: int64(len(raw)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+// stubTransport returns canned responses from a queue, one per RoundTrip
+// call, and records the requests it was handed so tests can assert on the
+// conditional-request headers the cache adds.
+type stubTransport struct {
+	responses []*http.Response
+	requests  []*http.Request
+}
+
+func (s *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.requests = append(s.requests, req)
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	return resp, nil
+}
+
+func newResponse(status int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+	}
+}
+
+func TestWebCacheStoresAndReplays304(t *testing.T) {
+	cache, err := NewWebCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewWebCache returned error: %v", err)
+	}
+
+	first := newResponse(http.StatusOK, http.Header{"Etag": []string{`"v1"`}}, "first body")
+	stub := &stubTransport{responses: []*http.Response{first}}
+	rt := cache.Transport(stub)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/page", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("first RoundTrip returned error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "first body" {
+		t.Fatalf("first response body = %q, want %q", body, "first body")
+	}
+
+	// Second request for the same URL should carry If-None-Match from the
+	// cached entry, and a 304 should be replayed from the cached body
+	// rather than handed back empty.
+	notModified := newResponse(http.StatusNotModified, nil, "")
+	stub.responses = []*http.Response{notModified}
+
+	req2, _ := http.NewRequest(http.MethodGet, "https://example.com/page", nil)
+	resp2, err := rt.RoundTrip(req2)
+	if err != nil {
+		t.Fatalf("second RoundTrip returned error: %v", err)
+	}
+
+	if got := stub.requests[1].Header.Get("If-None-Match"); got != `"v1"` {
+		t.Fatalf("If-None-Match = %q, want %q", got, `"v1"`)
+	}
+	if resp2.StatusCode != http.StatusOK {
+		t.Fatalf("replayed response status = %d, want 200", resp2.StatusCode)
+	}
+	body2, _ := ioutil.ReadAll(resp2.Body)
+	if string(body2) != "first body" {
+		t.Fatalf("replayed body = %q, want the cached body %q", body2, "first body")
+	}
+}
+
+func TestWebCacheSkipsNonGET(t *testing.T) {
+	cache, err := NewWebCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewWebCache returned error: %v", err)
+	}
+
+	resp := newResponse(http.StatusOK, http.Header{"Etag": []string{`"v1"`}}, "posted")
+	stub := &stubTransport{responses: []*http.Response{resp}}
+	rt := cache.Transport(stub)
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/page", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip returned error: %v", err)
+	}
+	if cache.load("https://example.com/page") != nil {
+		t.Fatal("a POST response should never be written to the cache")
+	}
+}
+
+func TestWebCacheSkipsErrorResponses(t *testing.T) {
+	cache, err := NewWebCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewWebCache returned error: %v", err)
+	}
+
+	resp := newResponse(http.StatusInternalServerError, http.Header{"Etag": []string{`"v1"`}}, "")
+	stub := &stubTransport{responses: []*http.Response{resp}}
+	rt := cache.Transport(stub)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/broken", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip returned error: %v", err)
+	}
+	if cache.load("https://example.com/broken") != nil {
+		t.Fatal("a 5xx response should never be written to the cache")
+	}
+}